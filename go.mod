@@ -3,6 +3,8 @@ module github.com/NerveNetwork/ndex-go-sdk
 go 1.14
 
 require (
+	github.com/btcsuite/btcd v0.0.0-20171128150713-2e60448ffcc6
 	github.com/gorilla/websocket v1.4.2
 	github.com/niels1286/nuls-go-sdk v0.0.0-20200514034711-7e4b847babf0
+	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
 )
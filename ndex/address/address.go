@@ -0,0 +1,206 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/11 上午10:00
+ */
+package address
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/niels1286/nuls-go-sdk/crypto/base58"
+	cryptoutils "github.com/niels1286/nuls-go-sdk/crypto/utils"
+)
+
+// chain ids and address prefixes of the known networks
+const (
+	MainnetChainId uint16 = 9
+	MainnetPrefix         = "NERVE"
+	TestnetChainId uint16 = 5
+	TestnetPrefix         = "TNVT"
+	NULSChainId    uint16 = 1
+	NULSPrefix            = "NULS"
+	TNULSChainId   uint16 = 2
+	TNULSPrefix           = "tNULS"
+)
+
+// address types
+const (
+	TypeNormal   uint8 = 1
+	TypeContract uint8 = 2
+	TypeP2SH     uint8 = 3
+)
+
+// length of the raw address: chain id(2) + type(1) + hash160(20)
+const BytesLength = 23
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// the character between prefix and base58 part, indexed by the length of the prefix
+var prefixSeparators = [...]byte{0, 'a', 'b', 'c', 'd', 'e'}
+
+var knownPrefixes = map[uint16]string{
+	MainnetChainId: MainnetPrefix,
+	TestnetChainId: TestnetPrefix,
+	NULSChainId:    NULSPrefix,
+	TNULSChainId:   TNULSPrefix,
+}
+
+/**
+ * A Nerve/NULS address, prefix + separator + base58(chainId + type + hash160 + xor checksum)
+ * Nerve/NULS 地址，格式为 前缀 + 分隔符 + base58(链ID + 地址类型 + hash160 + 异或校验位)
+ */
+type Address struct {
+	Prefix  string
+	ChainId uint16
+	Type    uint8
+	Hash160 []byte
+}
+
+/**
+ * Parse and validate an address: prefix, length, checksum, address type and, for known chains, the prefix of the chain
+ * 解析并校验地址：前缀、长度、校验位、地址类型，对已知的链还会校验前缀是否匹配
+ */
+func Parse(s string) (*Address, error) {
+	for length := 1; length < len(prefixSeparators) && length+1 < len(s); length++ {
+		if s[length] != prefixSeparators[length] {
+			continue
+		}
+		address, err := decode(s[:length], s[length+1:])
+		if err == nil {
+			return address, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+}
+
+func decode(prefix, encoded string) (*Address, error) {
+	raw := base58.Decode(encoded)
+	if len(raw) != BytesLength+1 {
+		return nil, ErrInvalidAddress
+	}
+	if checksum(raw[:BytesLength]) != raw[BytesLength] {
+		return nil, ErrInvalidAddress
+	}
+	address, err := FromBytes(raw[:BytesLength], prefix)
+	if err != nil {
+		return nil, err
+	}
+	if known, ok := knownPrefixes[address.ChainId]; ok && known != prefix {
+		return nil, ErrInvalidAddress
+	}
+	return address, nil
+}
+
+/**
+ * The prefix of a known chain
+ * 已知链的地址前缀
+ */
+func PrefixOf(chainId uint16) (string, bool) {
+	prefix, ok := knownPrefixes[chainId]
+	return prefix, ok
+}
+
+func Validate(s string) error {
+	_, err := Parse(s)
+	return err
+}
+
+/**
+ * Restore an address from its 23 raw bytes as stored in coin data and txData
+ * 从 coinData 和 txData 中保存的 23 字节原始地址还原地址
+ */
+func FromBytes(raw []byte, prefix string) (*Address, error) {
+	if len(raw) != BytesLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidAddress, len(raw))
+	}
+	if len(prefix) == 0 || len(prefix) >= len(prefixSeparators) {
+		return nil, fmt.Errorf("%w: prefix %q", ErrInvalidAddress, prefix)
+	}
+	address := &Address{
+		Prefix:  prefix,
+		ChainId: uint16(raw[0]) | uint16(raw[1])<<8,
+		Type:    raw[2],
+		Hash160: append([]byte(nil), raw[3:]...),
+	}
+	if address.Type < TypeNormal || address.Type > TypeP2SH {
+		return nil, fmt.Errorf("%w: address type %d", ErrInvalidAddress, address.Type)
+	}
+	return address, nil
+}
+
+/**
+ * Derive the normal address of a compressed public key on the given chain
+ * 根据压缩公钥推导指定链上的普通地址
+ */
+func FromPublicKey(publicKey []byte, chainId uint16, prefix string) (*Address, error) {
+	if len(publicKey) != 33 {
+		return nil, fmt.Errorf("public key must be 33 compressed bytes, got %d", len(publicKey))
+	}
+	if len(prefix) == 0 || len(prefix) >= len(prefixSeparators) {
+		return nil, fmt.Errorf("%w: prefix %q", ErrInvalidAddress, prefix)
+	}
+	return &Address{Prefix: prefix, ChainId: chainId, Type: TypeNormal, Hash160: cryptoutils.Hash160(publicKey)}, nil
+}
+
+func MainnetFromPublicKey(publicKey []byte) (*Address, error) {
+	return FromPublicKey(publicKey, MainnetChainId, MainnetPrefix)
+}
+
+func TestnetFromPublicKey(publicKey []byte) (*Address, error) {
+	return FromPublicKey(publicKey, TestnetChainId, TestnetPrefix)
+}
+
+/**
+ * Whether the address is the normal address of publicKey, the chain is taken from the address
+ * 地址是否为该公钥对应的普通地址，链ID取自地址本身
+ */
+func (address *Address) MatchesPublicKey(publicKey []byte) bool {
+	return address.Type == TypeNormal && bytes.Equal(address.Hash160, cryptoutils.Hash160(publicKey))
+}
+
+// the 23 raw bytes
+func (address *Address) Bytes() []byte {
+	raw := make([]byte, 0, BytesLength)
+	raw = append(raw, byte(address.ChainId), byte(address.ChainId>>8), address.Type)
+	return append(raw, address.Hash160...)
+}
+
+func (address *Address) String() string {
+	raw := address.Bytes()
+	encoded := base58.Encode(append(raw, checksum(raw)))
+	return address.Prefix + string(prefixSeparators[len(address.Prefix)]) + encoded
+}
+
+func checksum(raw []byte) byte {
+	xor := byte(0)
+	for _, b := range raw {
+		xor ^= b
+	}
+	return xor
+}
@@ -0,0 +1,118 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/14 上午11:05
+ */
+package address
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+const testPrivateKey = "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df"
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD",
+		"TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA",
+	} {
+		address, err := Parse(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if address.Prefix != TestnetPrefix || address.ChainId != TestnetChainId {
+			t.Errorf("%s parsed as chain %d prefix %s", s, address.ChainId, address.Prefix)
+		}
+		if address.String() != s {
+			t.Errorf("%s encoded back as %s", s, address.String())
+		}
+		restored, err := FromBytes(address.Bytes(), address.Prefix)
+		if err != nil || restored.String() != s {
+			t.Errorf("%s restored from bytes as %v, %v", s, restored, err)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	valid, _ := Parse("TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD")
+	wrongChain := *valid
+	wrongChain.Prefix = MainnetPrefix
+	wrongType := *valid
+	wrongType.Type = 9
+
+	for _, s := range []string{
+		"",
+		"TNVT",
+		"TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giE",
+		"TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9gi",
+		"TNVTcTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD",
+		wrongChain.String(),
+		wrongType.String(),
+	} {
+		if err := Validate(s); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%q: expected ErrInvalidAddress, got %v", s, err)
+		}
+	}
+}
+
+func TestFromPublicKey(t *testing.T) {
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	_, publicKey := btcec.PrivKeyFromBytes(btcec.S256(), privateKey)
+	compressed := publicKey.SerializeCompressed()
+
+	testnet, err := TestnetFromPublicKey(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testnet.String() != "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD" {
+		t.Errorf("testnet address %s", testnet)
+	}
+	mainnet, err := MainnetFromPublicKey(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := mainnet.String(); s[:6] != "NERVEe" || !bytes.Equal(mainnet.Hash160, testnet.Hash160) {
+		t.Errorf("mainnet address %s", s)
+	}
+	if parsed, err := Parse(mainnet.String()); err != nil || parsed.ChainId != MainnetChainId {
+		t.Errorf("mainnet address parsed as %v, %v", parsed, err)
+	}
+	if !mainnet.MatchesPublicKey(compressed) || !testnet.MatchesPublicKey(compressed) {
+		t.Error("derived address does not match its public key")
+	}
+	other, _ := Parse("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA")
+	if other.MatchesPublicKey(compressed) {
+		t.Error("foreign address matches the public key")
+	}
+	if _, err := TestnetFromPublicKey(publicKey.SerializeUncompressed()); err == nil {
+		t.Error("uncompressed public key was accepted")
+	}
+}
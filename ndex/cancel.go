@@ -0,0 +1,194 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/20 下午4:15
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type CancelStatus int
+
+const (
+	CancelStatusCancelled CancelStatus = iota + 1
+	CancelStatusAlreadyFilled	// filled, or cancelled elsewhere, before the cancel arrived; Order holds the final state
+	CancelStatusFailed
+)
+
+func (status CancelStatus) String() string {
+	switch status {
+	case CancelStatusCancelled:
+		return "cancelled"
+	case CancelStatusAlreadyFilled:
+		return "already filled"
+	case CancelStatusFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("CancelStatus(%d)", int(status))
+}
+
+/**
+ * The outcome of cancelling one order
+ * 单个订单的撤单结果
+ */
+type CancelResult struct {
+	OrderId	string
+	Status	CancelStatus
+	TxHash	string	// hash of the cancel transaction when Status is CancelStatusCancelled
+	Order	*Order	// the order as last seen, nil if it was never loaded
+	Err		error	// why the cancel failed when Status is CancelStatusFailed
+}
+
+/**
+ * CancelReport lists the result of every order of a bulk cancel, in the order the ids were given
+ * CancelReport 按传入顺序列出批量撤单中每个订单的结果
+ */
+type CancelReport struct {
+	Results	[]*CancelResult
+}
+
+func (report *CancelReport) filter(status CancelStatus) []*CancelResult {
+	var results []*CancelResult
+	for _, result := range report.Results {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (report *CancelReport) Cancelled() []*CancelResult {
+	return report.filter(CancelStatusCancelled)
+}
+
+func (report *CancelReport) AlreadyFilled() []*CancelResult {
+	return report.filter(CancelStatusAlreadyFilled)
+}
+
+func (report *CancelReport) Failed() []*CancelResult {
+	return report.filter(CancelStatusFailed)
+}
+
+/**
+ * Cancel every pending order of the configured address in symbol, or in all trading pairs if symbol is empty.
+ * Orders that could be listed are cancelled even if some symbols failed, their error is returned with the report
+ * 撤销配置地址在 symbol 下的所有挂单，symbol 为空时撤销所有交易对的挂单。部分交易对查询失败时仍会撤销已查到的订单，错误与报告一并返回
+ */
+func (market *Market) CancelAll(ctx context.Context, symbol string) (*CancelReport, error) {
+	signer, release, err := market.orderSigner()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var orders []*Order
+	var listErr error
+	if symbol != "" {
+		orders, listErr = market.GetOpenOrderByAddressCtx(ctx, signer.Address(), symbol)
+	} else {
+		orders, listErr = market.GetAllOpenOrders(ctx, signer.Address())
+	}
+	var symbolErrors *SymbolErrors
+	if listErr != nil && !errors.As(listErr, &symbolErrors) {
+		return nil, listErr
+	}
+	results := make([]*CancelResult, len(orders))
+	for i, order := range orders {
+		results[i] = &CancelResult{OrderId: order.Id, Order: order}
+	}
+	return market.cancelBulk(ctx, signer, results), listErr
+}
+
+/**
+ * Cancel the given orders of the configured address, the transactions are built, signed and broadcast in parallel
+ * 撤销配置地址的指定订单，交易的组装、签名和广播并行进行
+ */
+func (market *Market) CancelOrders(ctx context.Context, orderIds []string) (*CancelReport, error) {
+	signer, release, err := market.orderSigner()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	results := make([]*CancelResult, len(orderIds))
+	for i, orderId := range orderIds {
+		results[i] = &CancelResult{OrderId: orderId}
+	}
+	return market.cancelBulk(ctx, signer, results), nil
+}
+
+// whether the server refused the cancel; local failures, throttling and outages never reached the order
+func cancelRejected(err error) bool {
+	if errors.Is(err, ErrOrderNotFound) {
+		return true
+	}
+	var apiError *APIError
+	return errors.As(err, &apiError) && !errors.Is(err, ErrRateLimited) && !errors.Is(err, ErrServerUnavailable)
+}
+
+func (market *Market) cancelBulk(ctx context.Context, signer Signer, results []*CancelResult) *CancelReport {
+	// a repeated id is cancelled once and reported for every occurrence
+	first := map[string]*CancelResult{}
+	var unique []*CancelResult
+	for _, result := range results {
+		if _, ok := first[result.OrderId]; !ok {
+			first[result.OrderId] = result
+			unique = append(unique, result)
+		}
+	}
+	market.runBounded(ctx, len(unique), func(i int, err error) {
+		result := unique[i]
+		if err == nil {
+			result.TxHash, err = market.CancelOrderWithSignerCtx(ctx, signer, result.OrderId)
+		}
+		if err == nil {
+			result.Status = CancelStatusCancelled
+			return
+		}
+		result.Status, result.Err = CancelStatusFailed, err
+		if ctx.Err() != nil || !cancelRejected(err) {
+			return
+		}
+		// a cancel the server rejected because the order is already final is not a failure
+		if order, lookupErr := market.GetOrderCtx(ctx, result.OrderId); lookupErr == nil && order != nil {
+			result.Order = order
+			if order.Status.IsFinal() {
+				result.Status, result.Err = CancelStatusAlreadyFilled, nil
+			}
+		}
+	})
+	report := &CancelReport{Results: make([]*CancelResult, len(results))}
+	for i, result := range results {
+		if original := first[result.OrderId]; original != result {
+			copied := *original
+			result = &copied
+		}
+		report.Results[i] = result
+	}
+	return report
+}
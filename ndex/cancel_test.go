@@ -0,0 +1,168 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/20 下午4:15
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	openOrderId		= "82ad1756b22f480195c3f7eee5dfe2cf43e661b404f828255903cedb70172e40"
+	filledOrderId	= "b0113ba5efb8b3c0a01c7829e6b4e4e775437af7334a3bb02eb33b6db9beaee7"
+	brokenOrderId	= "1111111111111111111111111111111111111111111111111111111111111111"
+	tamperedOrderId	= "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+// cancels of filledOrderId and brokenOrderId are rejected, only the first is final on lookup;
+// the cancel tx built for tamperedOrderId cancels another order, which is final on lookup too
+type cancelServer struct {
+	t			*testing.T
+	mu			sync.Mutex
+	broadcasts	[]string
+}
+
+func (server *cancelServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&params)
+	switch {
+	case r.URL.Path == "/api/tradings":
+		serveTestdata(server.t, w, "tradings.json")
+	case strings.HasPrefix(r.URL.Path, "/api/openOrder/NVTNULS/"):
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []*Order{
+			{Id: openOrderId, Symbol: "NVTNULS", Status: OrderStatusOpen},
+			{Id: filledOrderId, Symbol: "NVTNULS", Status: OrderStatusPartiallyFilled},
+		}})
+	case strings.HasPrefix(r.URL.Path, "/api/openOrder/"):
+		w.Write([]byte(`{"code":0,"success":true,"msg":"success","data":[]}`))
+	case r.URL.Path == "/api/order/" + filledOrderId:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": &Order{Id: filledOrderId, Status: OrderStatusFilled}})
+	case r.URL.Path == "/api/order/" + tamperedOrderId:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": &Order{Id: tamperedOrderId, Status: OrderStatusFilled}})
+	case r.URL.Path == "/api/order/" + brokenOrderId:
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": &Order{Id: brokenOrderId, Status: OrderStatusOpen}})
+	case r.URL.Path == "/api/cancelOrder":
+		if params["orderId"] == filledOrderId || params["orderId"] == brokenOrderId {
+			w.Write([]byte(`{"code":1,"success":false,"msg":"stop here"}`))
+			return
+		}
+		if params["orderId"] == tamperedOrderId {
+			params["orderId"] = openOrderId
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": encodeTestTx(buildTestTx(r.URL.Path, params))})
+	case r.URL.Path == "/api/broadcast":
+		server.mu.Lock()
+		server.broadcasts = append(server.broadcasts, params["txHex"].(string))
+		server.mu.Unlock()
+		w.Write([]byte(`{"code":0,"success":true,"msg":"success","data":"` + openOrderId + `"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMarket_CancelAll(t *testing.T) {
+	backend := &cancelServer{t: t}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey))
+	report, err := m.CancelAll(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 || len(report.Cancelled()) != 1 || len(report.AlreadyFilled()) != 1 {
+		t.Fatalf("report %+v", report.Results)
+	}
+	cancelled := report.Cancelled()[0]
+	if cancelled.OrderId != openOrderId || cancelled.TxHash == "" {
+		t.Errorf("cancelled %+v", cancelled)
+	}
+	if filled := report.AlreadyFilled()[0]; filled.Order.Status != OrderStatusFilled || filled.Err != nil {
+		t.Errorf("already filled %+v", filled)
+	}
+	if len(backend.broadcasts) != 1 {
+		t.Fatalf("%d broadcasts", len(backend.broadcasts))
+	}
+	verifyBroadcastTx(t, backend.broadcasts[0])
+}
+
+func TestMarket_CancelOrders(t *testing.T) {
+	backend := &cancelServer{t: t}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey), WithFanOutConcurrency(2))
+	ids := []string{brokenOrderId, openOrderId, filledOrderId, openOrderId}
+	report, err := m.CancelOrders(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CancelStatus{CancelStatusFailed, CancelStatusCancelled, CancelStatusAlreadyFilled, CancelStatusCancelled}
+	for i, result := range report.Results {
+		if result.OrderId != ids[i] || result.Status != expected[i] {
+			t.Errorf("result %d: %s %s, expected %s", i, result.OrderId, result.Status, expected[i])
+		}
+	}
+	var apiError *APIError
+	if failed := report.Failed(); len(failed) != 1 || !errors.As(failed[0].Err, &apiError) {
+		t.Errorf("failed %+v", failed)
+	}
+	if len(backend.broadcasts) != 1 {
+		t.Errorf("the repeated id was cancelled %d times", len(backend.broadcasts))
+	}
+
+	if _, err := (&Market{Host: server.URL}).CancelOrders(context.Background(), ids); err == nil {
+		t.Error("cancel without a key was accepted")
+	}
+}
+
+func TestMarket_CancelOrdersLocalFailure(t *testing.T) {
+	backend := &cancelServer{t: t}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	// the order is final, but the cancel failed before it reached the server, so the error is kept
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey))
+	report, err := m.CancelOrders(context.Background(), []string{tamperedOrderId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := report.Results[0]; result.Status != CancelStatusFailed || !errors.Is(result.Err, ErrTxMismatch) {
+		t.Errorf("result %s %v", result.Status, result.Err)
+	}
+	if len(backend.broadcasts) != 0 {
+		t.Errorf("%d broadcasts", len(backend.broadcasts))
+	}
+}
@@ -0,0 +1,189 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/17 上午10:30
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// each sync keeps the sample with the shortest round trip, it brackets the server clock most tightly
+const clockSyncSamples = 3
+
+/**
+ * ClockSync tracks the offset between the local clock and the server clock, estimated from /api/time
+ * ClockSync 记录本地时钟与服务器时钟的偏差，根据 /api/time 估算
+ */
+type ClockSync struct {
+	mu			sync.RWMutex
+	offset		time.Duration	// server time minus local time
+	rtt			time.Duration
+	syncedAt	time.Time
+}
+
+func (clock *ClockSync) Offset() time.Duration {
+	clock.mu.RLock()
+	defer clock.mu.RUnlock()
+	return clock.offset
+}
+
+// round trip of the sample the offset was taken from
+func (clock *ClockSync) RTT() time.Duration {
+	clock.mu.RLock()
+	defer clock.mu.RUnlock()
+	return clock.rtt
+}
+
+// local time of the last successful sync, zero before the first one
+func (clock *ClockSync) SyncedAt() time.Time {
+	clock.mu.RLock()
+	defer clock.mu.RUnlock()
+	return clock.syncedAt
+}
+
+/**
+ * The current server time, the local time before the first sync
+ * 当前的服务器时间，首次同步前为本地时间
+ */
+func (clock *ClockSync) Now() time.Time {
+	return time.Now().Add(clock.Offset())
+}
+
+func (clock *ClockSync) update(offset, rtt time.Duration, at time.Time) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.offset = offset
+	clock.rtt = rtt
+	clock.syncedAt = at
+}
+
+/**
+ * The clock of the market, updated by SyncClock and StartClockSync
+ * Market 的时钟，由 SyncClock 及 StartClockSync 更新
+ */
+func (market *Market) Clock() *ClockSync {
+	return &market.clock
+}
+
+/**
+ * The current server time as estimated by the last clock sync
+ * 根据最近一次时钟同步估算的当前服务器时间
+ */
+func (market *Market) Now() time.Time {
+	return market.clock.Now()
+}
+
+/**
+ * Sample /api/time a few times and keep the offset of the fastest round trip
+ * 多次请求 /api/time，采用往返时间最短的一次的偏差
+ */
+func (market *Market) SyncClock(ctx context.Context) error {
+	var lastErr error
+	best := time.Duration(-1)
+	var offset time.Duration
+	for i := 0; i < clockSyncSamples; i++ {
+		start := time.Now()
+		serverTime, err := market.GetServeTimeCtx(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+		rtt := time.Since(start)
+		if best < 0 || rtt < best {
+			// the server read its clock somewhere during the round trip, assume the middle
+			best = rtt
+			offset = serverTime.Sub(start.Add(rtt / 2))
+		}
+	}
+	if best < 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no clock sample")
+		}
+		return lastErr
+	}
+	market.clock.update(offset, best, time.Now())
+	return nil
+}
+
+/**
+ * Sync the clock now and then every interval until ctx is done or the market is closed, only the first sync reports its error
+ * 立即同步时钟，此后每隔 interval 同步一次直到 ctx 结束或 Market 被关闭，只有首次同步返回错误
+ */
+func (market *Market) StartClockSync(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("clock sync interval must be positive")
+	}
+	if err := market.SyncClock(ctx); err != nil {
+		return err
+	}
+	market.goBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := market.SyncClock(ctx); err != nil && ctx.Err() == nil {
+					log.Println("ndex clock sync error : ", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// the server sends unix milliseconds
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms * int64(time.Millisecond))
+}
+
+// time of the latest trade
+func (ticker *Ticker) LastTradeTime() time.Time {
+	return fromMillis(ticker.Time)
+}
+
+// start of the kline period
+func (kline *Kline) OpenTime() time.Time {
+	return fromMillis(kline.Time)
+}
+
+func (orderBook *OrderBook) UpdatedAt() time.Time {
+	return fromMillis(orderBook.UpdateTime)
+}
+
+func (order *Order) CreatedAt() time.Time {
+	return fromMillis(order.CreateTime)
+}
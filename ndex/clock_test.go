@@ -0,0 +1,124 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/17 上午10:30
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMarket_GetServeTimeMillis(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveTestdata(t, w, "time.json")
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL))
+	serverTime, err := m.GetServeTimeCtx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverTime.UnixNano() != 1589271332077 * int64(time.Millisecond) {
+		t.Errorf("server time %s", serverTime)
+	}
+}
+
+func TestMarket_SyncClock(t *testing.T) {
+	server := newHealthServer(t, -time.Hour)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL))
+	if !m.Clock().SyncedAt().IsZero() {
+		t.Error("clock synced before the first sample")
+	}
+	if err := m.SyncClock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	clock := m.Clock()
+	if offset := clock.Offset(); offset > -time.Hour + time.Second || offset < -time.Hour - time.Second {
+		t.Errorf("offset %s", offset)
+	}
+	if clock.RTT() <= 0 || clock.SyncedAt().IsZero() {
+		t.Errorf("rtt %s synced at %s", clock.RTT(), clock.SyncedAt())
+	}
+	if drift := time.Until(m.Now()); drift > -time.Hour + time.Second || drift < -time.Hour - time.Second {
+		t.Errorf("server now is %s away", drift)
+	}
+}
+
+func TestMarket_StartClockSync(t *testing.T) {
+	var samples int32
+	handler := healthHandler(t, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&samples, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.StartClockSync(ctx, 10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if n := atomic.LoadInt32(&samples); n <= clockSyncSamples {
+		t.Errorf("%d samples, the clock was not synced in the background", n)
+	}
+	if err := m.StartClockSync(context.Background(), 0); err == nil {
+		t.Error("zero interval was accepted")
+	}
+}
+
+func TestTimeAccessors(t *testing.T) {
+	var ticker Ticker
+	var kline Kline
+	var orderBook OrderBook
+	var order Order
+	json.Unmarshal([]byte(`{"time":1589271332077}`), &ticker)
+	json.Unmarshal([]byte(`{"time":1589271332077}`), &kline)
+	json.Unmarshal([]byte(`{"updateTime":1589271332077}`), &orderBook)
+	json.Unmarshal([]byte(`{"createTime":1589271332077}`), &order)
+	expected := time.Date(2020, 5, 12, 8, 15, 32, 77 * int(time.Millisecond), time.UTC)
+	for name, actual := range map[string]time.Time{
+		"ticker": ticker.LastTradeTime(),
+		"kline": kline.OpenTime(),
+		"order book": orderBook.UpdatedAt(),
+		"order": order.CreatedAt(),
+	} {
+		if !actual.Equal(expected) {
+			t.Errorf("%s time %s", name, actual.UTC())
+		}
+	}
+}
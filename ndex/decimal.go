@@ -0,0 +1,387 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/10 上午9:30
+ */
+package ndex
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Decimal is an exact fixed-point number used for every price, quantity and balance.
+ * The zero value is 0, values are immutable and safe to copy.
+ * Decimal 为精确的定点数，用于所有价格、数量和余额。零值为 0，值不可变，可以安全复制。
+ */
+type Decimal struct {
+	value	*big.Int	// unscaled value, nil means 0
+	scale	int32		// digits after the decimal point
+}
+
+// largest exponent ParseDecimal accepts, far beyond any real amount and small enough to keep huge exponents from exhausting memory
+const maxDecimalExponent = 1000
+
+var (
+	bigOne	= big.NewInt(1)
+	bigTen	= big.NewInt(10)
+)
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+/**
+ * Create unscaled * 10^-scale, e.g. NewDecimal(123, 2) is 1.23
+ * 创建 unscaled * 10^-scale，例如 NewDecimal(123, 2) 为 1.23
+ */
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	if scale < 0 {
+		return Decimal{value: new(big.Int).Mul(big.NewInt(unscaled), pow10(-scale))}
+	}
+	return Decimal{value: big.NewInt(unscaled), scale: scale}
+}
+
+func NewDecimalFromInt(value int64) Decimal {
+	return NewDecimal(value, 0)
+}
+
+/**
+ * Convert an amount in chain units (e.g. 100000000 with 8 decimals) to a Decimal (1)
+ * 将链上最小单位的数量（例如 8 位小数的 100000000）转换为 Decimal（1）
+ */
+func NewDecimalFromBigInt(units *big.Int, decimals int) Decimal {
+	if units == nil {
+		return Decimal{}
+	}
+	return Decimal{value: new(big.Int).Set(units), scale: int32(decimals)}
+}
+
+/**
+ * Convert a float64 through its shortest decimal representation, 0.1 becomes exactly 0.1
+ * 通过 float64 的最短十进制表示进行转换，0.1 会精确地转换为 0.1
+ */
+func NewDecimalFromFloat(value float64) Decimal {
+	d, err := ParseDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+	if err != nil {
+		// NaN and Inf can not be represented
+		return Decimal{}
+	}
+	return d
+}
+
+/**
+ * Parse a decimal string such as "12", "-0.0446" or "1e-8", exponents are limited to ±1000
+ * 解析十进制字符串，例如 "12"、"-0.0446" 或 "1e-8"，指数限制在 ±1000 以内
+ */
+func ParseDecimal(s string) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return Decimal{}, errors.New("empty decimal")
+	}
+	exp := int64(0)
+	if idx := strings.IndexAny(text, "eE"); idx >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(text[idx+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		if exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			return Decimal{}, fmt.Errorf("decimal exponent out of range %q", s)
+		}
+		text = text[:idx]
+	}
+	negative := false
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+	intPart, fracPart := text, ""
+	if idx := strings.Index(text, "."); idx >= 0 {
+		intPart, fracPart = text[:idx], text[idx+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		value.Neg(value)
+	}
+	scale := int64(len(fracPart)) - exp
+	if scale < 0 {
+		value.Mul(value, pow10(int32(-scale)))
+		scale = 0
+	}
+	return Decimal{value: value, scale: int32(scale)}, nil
+}
+
+/**
+ * Same as ParseDecimal but panics on malformed input, meant for constants
+ * 同 ParseDecimal，格式错误时 panic，用于常量
+ */
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) unscaled() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// the same number with exactly scale fractional digits, only valid for scale >= d.scale
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.unscaled()
+	}
+	return new(big.Int).Mul(d.unscaled(), pow10(scale-d.scale))
+}
+
+func maxScale(a, b Decimal) int32 {
+	if a.scale > b.scale {
+		return a.scale
+	}
+	return b.scale
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	scale := maxScale(d, other)
+	return Decimal{value: new(big.Int).Add(d.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	scale := maxScale(d, other)
+	return Decimal{value: new(big.Int).Sub(d.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{value: new(big.Int).Mul(d.unscaled(), other.unscaled()), scale: d.scale + other.scale}
+}
+
+/**
+ * Divide and round half away from zero to places fractional digits, returns an error when dividing by zero
+ * 相除并四舍五入保留 places 位小数，除数为 0 时返回错误
+ */
+func (d Decimal) Div(other Decimal, places int32) (Decimal, error) {
+	if other.IsZero() {
+		return Decimal{}, errors.New("decimal division by zero")
+	}
+	// d/other = (dv * 10^(places+os)) / (ov * 10^ds) * 10^-places
+	numerator := new(big.Int).Mul(d.unscaled(), pow10(places+other.scale))
+	denominator := new(big.Int).Mul(other.unscaled(), pow10(d.scale))
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Sign() != 0 {
+		twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+		if twice.Cmp(new(big.Int).Abs(denominator)) >= 0 {
+			if numerator.Sign() * denominator.Sign() < 0 {
+				quotient.Sub(quotient, bigOne)
+			} else {
+				quotient.Add(quotient, bigOne)
+			}
+		}
+	}
+	return Decimal{value: quotient, scale: places}, nil
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.unscaled()), scale: d.scale}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.unscaled()), scale: d.scale}
+}
+
+// -1, 0 or +1
+func (d Decimal) Sign() int {
+	return d.unscaled().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// -1 if d < other, 0 if equal, +1 if d > other; 1.50 and 1.5 are equal
+func (d Decimal) Cmp(other Decimal) int {
+	scale := maxScale(d, other)
+	return d.rescale(scale).Cmp(other.rescale(scale))
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Decimal) LessThan(other Decimal) bool {
+	return d.Cmp(other) < 0
+}
+
+func (d Decimal) GreaterThan(other Decimal) bool {
+	return d.Cmp(other) > 0
+}
+
+type roundingMode int
+
+const (
+	roundHalfUp roundingMode = iota
+	roundDown				// toward zero
+	roundFloor				// toward negative infinity
+	roundCeil				// toward positive infinity
+)
+
+func (d Decimal) round(places int32, mode roundingMode) Decimal {
+	if places >= d.scale {
+		return d
+	}
+	divisor := pow10(d.scale - places)
+	quotient, remainder := new(big.Int).QuoRem(d.unscaled(), divisor, new(big.Int))
+	if remainder.Sign() != 0 {
+		switch mode {
+		case roundHalfUp:
+			twice := new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2))
+			if twice.Cmp(divisor) >= 0 {
+				quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+			}
+		case roundFloor:
+			if remainder.Sign() < 0 {
+				quotient.Sub(quotient, bigOne)
+			}
+		case roundCeil:
+			if remainder.Sign() > 0 {
+				quotient.Add(quotient, bigOne)
+			}
+		}
+	}
+	return Decimal{value: quotient, scale: places}
+}
+
+// round half away from zero to places fractional digits
+func (d Decimal) Round(places int32) Decimal {
+	return d.round(places, roundHalfUp)
+}
+
+// drop the digits after places, rounding toward zero
+func (d Decimal) Truncate(places int32) Decimal {
+	return d.round(places, roundDown)
+}
+
+func (d Decimal) Floor(places int32) Decimal {
+	return d.round(places, roundFloor)
+}
+
+func (d Decimal) Ceil(places int32) Decimal {
+	return d.round(places, roundCeil)
+}
+
+/**
+ * Number of significant fractional digits, 1.2300 has 2
+ * 有效小数位数，1.2300 为 2
+ */
+func (d Decimal) Precision() int32 {
+	value := new(big.Int).Set(d.unscaled())
+	scale := d.scale
+	remainder := new(big.Int)
+	for scale > 0 && value.Sign() != 0 {
+		quotient, r := new(big.Int).QuoRem(value, bigTen, remainder)
+		if r.Sign() != 0 {
+			break
+		}
+		value = quotient
+		scale--
+	}
+	if value.Sign() == 0 {
+		return 0
+	}
+	return scale
+}
+
+/**
+ * Convert to chain units with the given number of decimals, fails if digits would be lost
+ * 按指定小数位数转换为链上最小单位，如果会丢失精度则返回错误
+ */
+func (d Decimal) BigInt(decimals int) (*big.Int, error) {
+	if d.Precision() > int32(decimals) {
+		return nil, fmt.Errorf("%s has more than %d decimals", d.String(), decimals)
+	}
+	if int32(decimals) >= d.scale {
+		return d.rescale(int32(decimals)), nil
+	}
+	return d.round(int32(decimals), roundDown).unscaled(), nil
+}
+
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func (d Decimal) String() string {
+	value := d.unscaled()
+	digits := new(big.Int).Abs(value).String()
+	if d.scale > 0 {
+		if int32(len(digits)) <= d.scale {
+			digits = strings.Repeat("0", int(d.scale)-len(digits)+1) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if value.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// encoded as a json number, e.g. 0.0446, so the server never receives a rounded float
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// accepts json numbers and numeric strings
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	text = strings.Trim(text, "\"")
+	parsed, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,148 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/10 下午3:20
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	sum := MustParseDecimal("0.1").Add(MustParseDecimal("0.2"))
+	if sum.String() != "0.3" || !sum.Equal(MustParseDecimal("0.30")) {
+		t.Errorf("0.1 + 0.2 = %s", sum)
+	}
+	if got := MustParseDecimal("1.5").Sub(MustParseDecimal("2.25")).String(); got != "-0.75" {
+		t.Errorf("1.5 - 2.25 = %s", got)
+	}
+	if got := MustParseDecimal("0.0446").Mul(NewDecimalFromInt(100)).String(); got != "4.4600" {
+		t.Errorf("0.0446 * 100 = %s", got)
+	}
+	quotient, err := NewDecimalFromInt(2).Div(NewDecimalFromInt(3), 4)
+	if err != nil || quotient.String() != "0.6667" {
+		t.Errorf("2 / 3 = %s, %v", quotient, err)
+	}
+	if _, err := NewDecimalFromInt(1).Div(Decimal{}, 2); err == nil {
+		t.Error("division by zero was accepted")
+	}
+	if !MustParseDecimal("1e-8").Equal(NewDecimal(1, 8)) || MustParseDecimal("-2.5E2").String() != "-250" {
+		t.Error("exponent notation was not parsed")
+	}
+	for _, text := range []string{"1e2000000000", "1e-2000000000", "1e1001", "1e99999999999"} {
+		if _, err := ParseDecimal(text); err == nil {
+			t.Errorf("exponent of %s was accepted", text)
+		}
+	}
+	if d, err := ParseDecimal("1e-1000"); err != nil || !d.Equal(NewDecimal(1, 1000)) {
+		t.Errorf("largest exponent was rejected: %v", err)
+	}
+	if !(Decimal{}).IsZero() || NewDecimalFromFloat(0.1).String() != "0.1" {
+		t.Error("unexpected zero value or float conversion")
+	}
+}
+
+func TestDecimal_Rounding(t *testing.T) {
+	cases := []struct {
+		value, round, truncate, floor, ceil string
+	}{
+		{"1.245", "1.25", "1.24", "1.24", "1.25"},
+		{"-1.245", "-1.25", "-1.24", "-1.25", "-1.24"},
+		{"1.2", "1.2", "1.2", "1.2", "1.2"},
+		{"0.004", "0.00", "0.00", "0.00", "0.01"},
+	}
+	for _, c := range cases {
+		d := MustParseDecimal(c.value)
+		got := []string{d.Round(2).String(), d.Truncate(2).String(), d.Floor(2).String(), d.Ceil(2).String()}
+		want := []string{c.round, c.truncate, c.floor, c.ceil}
+		for i := range got {
+			if !MustParseDecimal(got[i]).Equal(MustParseDecimal(want[i])) {
+				t.Errorf("%s: got %v, want %v", c.value, got, want)
+				break
+			}
+		}
+	}
+	if p := MustParseDecimal("1.2300").Precision(); p != 2 {
+		t.Errorf("precision of 1.2300 = %d", p)
+	}
+}
+
+func TestDecimal_ChainUnits(t *testing.T) {
+	symbol := &Symbol{BaseDecimal: 8, QuoteDecimal: 6}
+	units, err := symbol.QuantityUnits(MustParseDecimal("1.5"))
+	if err != nil || units.String() != "150000000" {
+		t.Errorf("units = %v, %v", units, err)
+	}
+	if _, err := symbol.PriceUnits(MustParseDecimal("0.0000001")); err == nil {
+		t.Error("sub-unit price was accepted")
+	}
+	if got := symbol.PriceFromUnits(big.NewInt(44600)).String(); got != "0.044600" {
+		t.Errorf("price from units = %s", got)
+	}
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	var ticker Ticker
+	if err := json.Unmarshal([]byte(`{"last":0.30000000000000004,"ask":"0.3","bid":null}`), &ticker); err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Last.String() != "0.30000000000000004" || ticker.Ask.String() != "0.3" || !ticker.Bid.IsZero() {
+		t.Errorf("decoded %s %s %s", ticker.Last, ticker.Ask, ticker.Bid)
+	}
+	encoded, _ := json.Marshal(map[string]interface{}{"price": MustParseDecimal("0.3")})
+	if string(encoded) != `{"price":0.3}` {
+		t.Errorf("encoded %s", encoded)
+	}
+}
+
+func TestMarket_NewOrderSendsExactDecimals(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tradings" {
+			serveTestdata(t, w, "tradings.json")
+			return
+		}
+		raw, _ := ioutil.ReadAll(r.Body)
+		body = string(raw)
+		w.Write([]byte(`{"code":1,"success":false,"msg":"stop here"}`))
+	}))
+	defer server.Close()
+
+	m := &Market{Host: server.URL}
+	price := MustParseDecimal("0.1").Add(MustParseDecimal("0.2"))
+	m.NewOrderByAddressCtx(context.Background(), "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD", "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df", "NVTNULS", SideBuy, price, MustParseDecimal("12.5"))
+	if !strings.Contains(body, `"price":0.3`) || !strings.Contains(body, `"quantity":12.5`) {
+		t.Errorf("order request body %s", body)
+	}
+}
@@ -0,0 +1,217 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/8 下午4:10
+ */
+package ndex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/**
+ * DecodeError lists the differences between a payload and the model it was decoded into
+ * DecodeError 列出返回数据与解析模型之间的差异
+ */
+type DecodeError struct {
+	Endpoint	string
+	Unknown		[]string	// payload fields the model does not declare, e.g. data[0].feeRate
+	Missing		[]string	// model fields absent from the payload, fields tagged omitempty are optional
+}
+
+func (e *DecodeError) Error() string {
+	var parts []string
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "unknown fields: " + strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing fields: " + strings.Join(e.Missing, ", "))
+	}
+	return fmt.Sprintf("[%s] response does not match the model, %s", e.Endpoint, strings.Join(parts, "; "))
+}
+
+/**
+ * Decode data into v like json.Unmarshal, then report unknown and missing fields as *DecodeError.
+ * v is fully decoded even when a *DecodeError is returned.
+ * 与 json.Unmarshal 一样解析 data 到 v，然后以 *DecodeError 报告未知字段和缺失字段。即使返回 *DecodeError，v 也已完整解析。
+ */
+func DecodeStrict(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if report := checkStrict(data, v); report != nil {
+		return report
+	}
+	return nil
+}
+
+/**
+ * Decode every rest response strictly and fail the call on API drift, meant for canaries and integration tests
+ * 严格解析每个 rest 返回值，接口字段变化时调用失败，适用于金丝雀和集成测试
+ */
+func WithStrictDecoding() Option {
+	return func(config *marketConfig) error {
+		config.market.strictDecoding = true
+		return nil
+	}
+}
+
+func checkStrict(data []byte, v interface{}) *DecodeError {
+	var raw interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&raw) != nil {
+		return nil
+	}
+	report := &DecodeError{}
+	checkFields("", raw, reflect.TypeOf(v), report)
+	if len(report.Unknown) == 0 && len(report.Missing) == 0 {
+		return nil
+	}
+	sort.Strings(report.Unknown)
+	sort.Strings(report.Missing)
+	return report
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+type jsonField struct {
+	typ			reflect.Type
+	optional	bool
+}
+
+func checkFields(path string, raw interface{}, t reflect.Type, report *DecodeError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// types with their own decoding are leaves
+	if raw == nil || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		seen := map[string]bool{}
+		for key, value := range object {
+			name, field, ok := lookupField(fields, key)
+			if !ok {
+				report.Unknown = append(report.Unknown, joinPath(path, key))
+				continue
+			}
+			seen[name] = true
+			checkFields(joinPath(path, name), value, field.typ, report)
+		}
+		for name, field := range fields {
+			if !seen[name] && !field.optional {
+				report.Missing = append(report.Missing, joinPath(path, name))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			checkFields(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), report)
+		}
+	case reflect.Map:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key, value := range object {
+			checkFields(joinPath(path, key), value, t.Elem(), report)
+		}
+	}
+}
+
+// json field names of t, fields of embedded structs are promoted like encoding/json does
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		options := ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, options = tag[:idx], tag[idx:]
+		}
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for k, v := range jsonFields(embedded) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = jsonField{typ: f.Type, optional: strings.Contains(options, ",omitempty")}
+	}
+	return fields
+}
+
+// encoding/json prefers an exact match and falls back to a case-insensitive one
+func lookupField(fields map[string]jsonField, key string) (string, jsonField, bool) {
+	if field, ok := fields[key]; ok {
+		return key, field, true
+	}
+	for name, field := range fields {
+		if strings.EqualFold(name, key) {
+			return name, field, true
+		}
+	}
+	return "", jsonField{}, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,213 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/3 下午2:30
+ */
+package ndex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+/**
+ * Sentinel errors, use errors.Is to check the cause of an *APIError
+ * 哨兵错误，使用 errors.Is 判断 *APIError 的原因
+ */
+var (
+	ErrInsufficientBalance	= errors.New("ndex: insufficient balance")
+	ErrOrderNotFound		= errors.New("ndex: order not found")
+	ErrSymbolUnknown		= errors.New("ndex: unknown symbol")
+	ErrRateLimited			= errors.New("ndex: rate limited")
+	ErrNonceConflict		= errors.New("ndex: nonce conflict")
+	ErrServerUnavailable	= errors.New("ndex: server unavailable")
+	ErrTxDuplicate			= errors.New("ndex: transaction already exists")
+	ErrInvalidOrder			= errors.New("ndex: invalid order")
+	ErrTxMismatch			= errors.New("ndex: transaction does not match the request")
+	ErrSignerClosed			= errors.New("ndex: signer is closed")
+	ErrWrongPassword		= errors.New("ndex: wrong keystore password")
+	ErrClockSkew			= errors.New("ndex: local clock is out of sync with the server")
+	ErrWsClosed				= errors.New("ndex: websocket is closed")
+	ErrHeartbeatTimeout		= errors.New("ndex: websocket heartbeat timed out")
+	ErrStaleOrderBook		= errors.New("ndex: order book update is older than the local book")
+	ErrInsufficientDepth	= errors.New("ndex: not enough depth in the order book")
+)
+
+/**
+ * InitError lists every problem found by Initialize or CheckHealth, errors.Is matches any of them
+ * InitError 列出 Initialize 或 CheckHealth 发现的所有问题，errors.Is 可匹配其中任意一个
+ */
+type InitError struct {
+	Problems	[]error
+}
+
+func newInitError(problems []error) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &InitError{Problems: problems}
+}
+
+func (e *InitError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		messages[i] = problem.Error()
+	}
+	return fmt.Sprintf("ndex: %d problem(s) found: %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+func (e *InitError) Is(target error) bool {
+	for _, problem := range e.Problems {
+		if errors.Is(problem, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *InitError) As(target interface{}) bool {
+	for _, problem := range e.Problems {
+		if errors.As(problem, target) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * APIError describes a failed call, either a non-200 http status or a response with success=false
+ * APIError 描述一次失败的调用，可能是非 200 的 http 状态码，也可能是 success=false 的返回值
+ */
+type APIError struct {
+	Code		int		// code returned by the server, 0 if the body could not be parsed
+	Msg			string
+	Endpoint	string	// request uri, e.g. /api/order
+	HTTPStatus	int
+	RawBody		[]byte
+
+	cause		error
+}
+
+func (e *APIError) Error() string {
+	if e.HTTPStatus != http.StatusOK && e.Msg == "" {
+		return fmt.Sprintf("[%s] error http code :%d", e.Endpoint, e.HTTPStatus)
+	}
+	return fmt.Sprintf("[%s] the server return false, code=%d , msg=%s", e.Endpoint, e.Code, e.Msg)
+}
+
+// Unwrap returns the matching sentinel error, or nil if the failure is not classified
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+var (
+	errorCodesLock	sync.RWMutex
+	errorCodes		= map[int]error{}
+)
+
+/**
+ * Map a server error code to a sentinel error, codes take precedence over message matching
+ * 将服务器错误码映射为哨兵错误，错误码优先于错误信息匹配
+ */
+func RegisterErrorCode(code int, sentinel error) {
+	errorCodesLock.Lock()
+	defer errorCodesLock.Unlock()
+	errorCodes[code] = sentinel
+}
+
+// message fragments, lower case, checked in order
+var errorMessages = []struct {
+	fragments	[]string
+	sentinel	error
+}{
+	{[]string{"insufficient", "balance not enough", "not enough balance", "余额不足"}, ErrInsufficientBalance},
+	{[]string{"tx already exist", "transaction already exist", "repeat", "duplicate", "already used", "交易已存在", "重复"}, ErrTxDuplicate},
+	// a bare "nonce" would also catch duplicate rejections that mention the nonce, only conflict wordings are listed
+	{[]string{"nonce conflict", "nonce error", "nonce mismatch", "nonce not match", "invalid nonce", "nonce invalid",
+		"wrong nonce", "orphan", "孤儿交易"}, ErrNonceConflict},
+	{[]string{"too many", "rate limit", "frequent", "请求过于频繁"}, ErrRateLimited},
+	{[]string{"order not exist", "order not found", "order does not exist", "订单不存在"}, ErrOrderNotFound},
+	{[]string{"symbol not exist", "symbol not found", "unknown symbol", "trading not exist", "交易对不存在"}, ErrSymbolUnknown},
+}
+
+func classifyError(e *APIError) error {
+	errorCodesLock.RLock()
+	sentinel := errorCodes[e.Code]
+	errorCodesLock.RUnlock()
+	if sentinel != nil && e.Code != 0 {
+		return sentinel
+	}
+	if e.HTTPStatus == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	msg := strings.ToLower(e.Msg)
+	for _, rule := range errorMessages {
+		for _, fragment := range rule.fragments {
+			if strings.Contains(msg, fragment) {
+				return rule.sentinel
+			}
+		}
+	}
+	if e.HTTPStatus >= 500 {
+		return ErrServerUnavailable
+	}
+	return nil
+}
+
+func newAPIError(endpoint string, httpStatus int, base *BaseResponse, rawBody []byte) *APIError {
+	apiError := &APIError{
+		Endpoint:	endpoint,
+		HTTPStatus:	httpStatus,
+		RawBody:	rawBody,
+	}
+	if base != nil {
+		apiError.Code = base.Code
+		apiError.Msg = base.Msg
+	}
+	apiError.cause = classifyError(apiError)
+	return apiError
+}
+
+// converts a transport level *utils.HttpError into an *APIError, other errors are returned unchanged
+func wrapHttpError(endpoint string, err error) error {
+	var httpError *utils.HttpError
+	if !errors.As(err, &httpError) {
+		return err
+	}
+	// the gateway may still describe the failure in a json body
+	var base *BaseResponse
+	parsed := &BaseResponse{}
+	if json.Unmarshal(httpError.Body, parsed) == nil {
+		base = parsed
+	}
+	return newAPIError(endpoint, httpError.StatusCode, base, httpError.Body)
+}
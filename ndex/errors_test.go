@@ -0,0 +1,116 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/3 下午3:05
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIError_Classification(t *testing.T) {
+	RegisterErrorCode(10086, ErrNonceConflict)
+	cases := []struct {
+		status		int
+		body		string
+		sentinel	error
+		code		int
+	}{
+		{http.StatusOK, `{"code":1001,"success":false,"msg":"Insufficient balance"}`, ErrInsufficientBalance, 1001},
+		{http.StatusOK, `{"code":10086,"success":false,"msg":"tx rejected"}`, ErrNonceConflict, 10086},
+		{http.StatusOK, `{"code":1002,"success":false,"msg":"order not exist"}`, ErrOrderNotFound, 1002},
+		{http.StatusTooManyRequests, `slow down`, ErrRateLimited, 0},
+		{http.StatusBadGateway, `<html>bad gateway</html>`, ErrServerUnavailable, 0},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		m := &Market{Host: server.URL}
+		_, err := m.GetTickerCtx(context.Background(), "NVTNULS")
+		server.Close()
+
+		if !errors.Is(err, c.sentinel) {
+			t.Errorf("%s: errors.Is(%v, %v) = false", c.body, err, c.sentinel)
+		}
+		var apiError *APIError
+		if !errors.As(err, &apiError) {
+			t.Fatalf("%s: error %T is not an *APIError", c.body, err)
+		}
+		if apiError.HTTPStatus != c.status || apiError.Code != c.code || apiError.Endpoint != "/api/ticker/NVTNULS" {
+			t.Errorf("unexpected error fields %+v", apiError)
+		}
+		if string(apiError.RawBody) != c.body {
+			t.Errorf("raw body = %q", apiError.RawBody)
+		}
+	}
+}
+
+func TestAPIError_NonceWordings(t *testing.T) {
+	cases := map[string]error{
+		"tx already exists": ErrTxDuplicate,
+		"Transaction nonce repeated": ErrTxDuplicate,
+		"duplicate nonce 4c2ad8e1e7b3d0f1": ErrTxDuplicate,
+		"nonce already used": ErrTxDuplicate,
+		"Orphan transaction": ErrNonceConflict,
+		"invalid nonce": ErrNonceConflict,
+		"nonce conflict, expected 4c2ad8e1e7b3d0f1": ErrNonceConflict,
+		"balance not enough, nonce 4c2ad8e1e7b3d0f1": ErrInsufficientBalance,
+		"nonce 4c2ad8e1e7b3d0f1 locked by a pending tx": nil,
+	}
+	for msg, sentinel := range cases {
+		got := classifyError(&APIError{HTTPStatus: http.StatusOK, Code: 1, Msg: msg})
+		if got != sentinel {
+			t.Errorf("%q classified as %v, want %v", msg, got, sentinel)
+		}
+	}
+}
+
+func TestAPIError_Unclassified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":1,"success":false,"msg":"something else"}`))
+	}))
+	defer server.Close()
+
+	_, err := (&Market{Host: server.URL}).GetSymbolsCtx(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, sentinel := range []error{ErrInsufficientBalance, ErrOrderNotFound, ErrSymbolUnknown, ErrRateLimited, ErrNonceConflict, ErrServerUnavailable} {
+		if errors.Is(err, sentinel) {
+			t.Errorf("unexpected match with %v", sentinel)
+		}
+	}
+	if err.Error() != "[/api/tradings] the server return false, code=1 , msg=something else" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
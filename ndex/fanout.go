@@ -0,0 +1,196 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/19 上午11:00
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// requests in flight at once when a call fans out over all symbols
+const DefaultFanOutConcurrency = 4
+
+/**
+ * SymbolErrors reports the symbols whose requests failed during a fan-out, the orders of the other symbols are still returned
+ * SymbolErrors 记录分发请求中失败的交易对，其他交易对的订单仍会返回
+ */
+type SymbolErrors struct {
+	Errors	map[string]error
+}
+
+func (e *SymbolErrors) Error() string {
+	symbols := make([]string, 0, len(e.Errors))
+	for symbol := range e.Errors {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	messages := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		messages[i] = fmt.Sprintf("%s: %v", symbol, e.Errors[symbol])
+	}
+	return fmt.Sprintf("ndex: %d symbol(s) failed: %s", len(symbols), strings.Join(messages, "; "))
+}
+
+func (e *SymbolErrors) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Limit how many requests GetAllOpenOrders, GetAllOrders and the bulk cancels send at once, DefaultFanOutConcurrency by default
+ * 限制 GetAllOpenOrders、GetAllOrders 及批量撤单同时发送的请求数，默认为 DefaultFanOutConcurrency
+ */
+func WithFanOutConcurrency(n int) Option {
+	return func(config *marketConfig) error {
+		if n <= 0 {
+			return errors.New("fan-out concurrency must be positive")
+		}
+		config.market.fanOutConcurrency = n
+		return nil
+	}
+}
+
+/**
+ * Get the pending orders of an address in every trading pair, newest first. Failed symbols are reported
+ * in a *SymbolErrors next to the orders of the others. An empty address uses the configured one
+ * 获取地址在所有交易对下的挂单，按创建时间从新到旧排序。失败的交易对通过 *SymbolErrors 返回，其余交易对的订单照常返回。地址为空时使用配置的地址
+ */
+func (market *Market) GetAllOpenOrders(ctx context.Context, address string) ([]*Order, error) {
+	return market.fanOut(ctx, address, "", func(address, symbol string) ([]*Order, error) {
+		return market.GetOpenOrderByAddressCtx(ctx, address, symbol)
+	})
+}
+
+/**
+ * Get the order history of an address in every trading pair matching filter, newest first, filter.Symbol limits it
+ * to one pair. Failed symbols are reported in a *SymbolErrors next to the orders of the others
+ * 获取地址在所有交易对下符合 filter 的订单历史，按创建时间从新到旧排序，filter.Symbol 可限定单个交易对。失败的交易对通过 *SymbolErrors 返回
+ */
+func (market *Market) GetAllOrders(ctx context.Context, address string, filter OrderFilter) ([]*Order, error) {
+	return market.fanOut(ctx, address, filter.Symbol, func(address, symbol string) ([]*Order, error) {
+		symbolFilter := filter
+		symbolFilter.Address = address
+		symbolFilter.Symbol = symbol
+		it, err := market.IterateOrders(ctx, symbolFilter)
+		if err != nil {
+			return nil, err
+		}
+		defer it.Close()
+		var orders []*Order
+		for it.Next() {
+			orders = append(orders, it.Order())
+		}
+		return orders, it.Err()
+	})
+}
+
+// run fetch for every cached symbol, or only the given one, with bounded concurrency and merge the orders newest first
+func (market *Market) fanOut(ctx context.Context, address, only string, fetch func(address, symbol string) ([]*Order, error)) ([]*Order, error) {
+	if address == "" {
+		address = market.Address
+	}
+	if address == "" {
+		return nil, errors.New("No address is configured")
+	}
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
+	var names []string
+	if only != "" {
+		names = []string{only}
+	} else {
+		symbols, err := market.Symbols(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, symbol := range symbols {
+			names = append(names, symbol.Symbol)
+		}
+	}
+	var (
+		mu		sync.Mutex
+		orders	[]*Order
+		failed	= map[string]error{}
+	)
+	market.runBounded(ctx, len(names), func(i int, err error) {
+		var result []*Order
+		if err == nil {
+			result, err = fetch(address, names[i])
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		orders = append(orders, result...)
+		if err != nil {
+			failed[names[i]] = err
+		}
+	})
+
+	sort.SliceStable(orders, func(i, j int) bool {
+		if orders[i].CreateTime != orders[j].CreateTime {
+			return orders[i].CreateTime > orders[j].CreateTime
+		}
+		return orders[i].Id < orders[j].Id
+	})
+	if len(failed) > 0 {
+		return orders, &SymbolErrors{Errors: failed}
+	}
+	return orders, nil
+}
+
+// call task for 0..n-1 with at most the fan-out concurrency running, err is ctx.Err() for tasks that never got a slot
+func (market *Market) runBounded(ctx context.Context, n int, task func(i int, err error)) {
+	concurrency := market.fanOutConcurrency
+	if concurrency == 0 {
+		concurrency = DefaultFanOutConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				task(i, nil)
+			case <-ctx.Done():
+				task(i, ctx.Err())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,127 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/19 上午11:00
+ */
+package ndex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMarket_GetAllOpenOrders(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tradings" {
+			serveTestdata(t, w, "tradings.json")
+			return
+		}
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/openOrder/NVTNULS/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []*Order{
+				{Id: "a", Symbol: "NVTNULS", CreateTime: 1000},
+				{Id: "c", Symbol: "NVTNULS", CreateTime: 3000},
+			}})
+		case strings.HasPrefix(r.URL.Path, "/api/openOrder/NVTUSDT/"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": []*Order{
+				{Id: "b", Symbol: "NVTUSDT", CreateTime: 2000},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithFanOutConcurrency(1))
+	orders, err := m.GetAllOpenOrders(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, order := range orders {
+		ids = append(ids, order.Id)
+	}
+	if strings.Join(ids, ",") != "c,b,a" {
+		t.Errorf("orders %v, expected newest first", ids)
+	}
+	if atomic.LoadInt32(&maxInFlight) != 1 {
+		t.Errorf("%d requests in flight", maxInFlight)
+	}
+}
+
+func TestMarket_GetAllOrders(t *testing.T) {
+	history := &orderHistoryServer{orders: testOrderHistory(5)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tradings" {
+			serveTestdata(t, w, "tradings.json")
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var params struct {
+			Symbol	string	`json:"symbol"`
+		}
+		json.Unmarshal(body, &params)
+		if params.Symbol == "NVTUSDT" {
+			w.Write([]byte(`{"code":1,"success":false,"msg":"stop here"}`))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		history.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	orders, err := m.GetAllOrders(context.Background(), testAddress, OrderFilter{Side: SideBuy, PageSize: 2})
+	var symbolErrors *SymbolErrors
+	if !errors.As(err, &symbolErrors) || len(symbolErrors.Errors) != 1 || symbolErrors.Errors["NVTUSDT"] == nil {
+		t.Fatalf("expected NVTUSDT to fail, got %v", err)
+	}
+	if len(orders) != 3 || orders[0].Id != "order-5" || orders[2].Id != "order-1" {
+		t.Errorf("%d orders of the other symbol", len(orders))
+	}
+	if _, err := m.GetAllOrders(context.Background(), testAddress, OrderFilter{Symbol: "NVTNULS"}); err != nil {
+		t.Error(err)
+	}
+}
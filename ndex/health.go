@@ -0,0 +1,122 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/15 上午9:40
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/**
+ * Largest accepted difference between the local clock and the server time during CheckHealth
+ * CheckHealth 时本地时钟与服务器时间允许的最大偏差
+ */
+const DefaultMaxClockSkew = 5 * time.Second
+
+/**
+ * Create a market and check it against the server before returning it, so a bot fails at boot instead of on its first order.
+ * A market that fails the check is closed
+ * 创建 Market 并在返回前检查服务器状态，使程序在启动时而不是首次下单时失败。未通过检查的 Market 会被关闭
+ */
+func Dial(ctx context.Context, opts ...Option) (*Market, error) {
+	market, err := NewMarket(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := market.CheckHealth(ctx); err != nil {
+		// drop the websocket dialed by the check and wipe the unlocked key
+		market.Close(ctx)
+		return nil, err
+	}
+	return market, nil
+}
+
+/**
+ * Sync the clock and compare it with the server time, load the symbol list and, with WithWebsocketCheck, dial the websocket.
+ * The returned *InitError lists every problem found, the websocket is only dialed when everything else passed
+ * 同步时钟并与服务器时间比较，加载交易对列表，设置 WithWebsocketCheck 时连接 websocket。
+ * 返回的 *InitError 列出发现的所有问题，只有其他检查全部通过时才会连接 websocket
+ */
+func (market *Market) CheckHealth(ctx context.Context) error {
+	var problems []error
+	if err := market.checkClockSkew(ctx); err != nil {
+		problems = append(problems, fmt.Errorf("server time: %w", err))
+	}
+	if err := market.RefreshSymbols(ctx); err != nil {
+		problems = append(problems, fmt.Errorf("symbols: %w", err))
+	}
+	if market.websocketCheck && len(problems) == 0 {
+		if _, err := market.getWebsocket(ctx); err != nil {
+			problems = append(problems, fmt.Errorf("websocket: %w", err))
+		}
+	}
+	return newInitError(problems)
+}
+
+func (market *Market) checkClockSkew(ctx context.Context) error {
+	maxSkew := market.maxClockSkew
+	if maxSkew == 0 {
+		maxSkew = DefaultMaxClockSkew
+	}
+	if err := market.SyncClock(ctx); err != nil {
+		return err
+	}
+	skew := market.clock.Offset()
+	if skew > maxSkew || skew < -maxSkew {
+		return fmt.Errorf("%w: server time is %s ahead of the local clock, at most %s is accepted", ErrClockSkew, skew, maxSkew)
+	}
+	return nil
+}
+
+/**
+ * Set the largest accepted difference between the local clock and the server time, DefaultMaxClockSkew is used by default
+ * 设置本地时钟与服务器时间允许的最大偏差，默认为 DefaultMaxClockSkew
+ */
+func WithMaxClockSkew(maxSkew time.Duration) Option {
+	return func(config *marketConfig) error {
+		if maxSkew <= 0 {
+			return errors.New("max clock skew must be positive")
+		}
+		config.market.maxClockSkew = maxSkew
+		return nil
+	}
+}
+
+/**
+ * Dial the websocket during CheckHealth and Dial
+ * 在 CheckHealth 及 Dial 时连接 websocket
+ */
+func WithWebsocketCheck() Option {
+	return func(config *marketConfig) error {
+		config.market.websocketCheck = true
+		return nil
+	}
+}
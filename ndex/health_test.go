@@ -0,0 +1,128 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/15 上午9:40
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/ndex/address"
+)
+
+func newHealthServer(t *testing.T, offset time.Duration) *httptest.Server {
+	return httptest.NewServer(healthHandler(t, offset))
+}
+
+// serves /api/time with the local clock shifted by offset, and the symbol list
+func healthHandler(t *testing.T, offset time.Duration) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/time":
+			now := time.Now().Add(offset).UnixNano() / int64(time.Millisecond)
+			fmt.Fprintf(w, `{"code":0,"success":true,"msg":"success","data":%d}`, now)
+		case "/api/tradings":
+			serveTestdata(t, w, "tradings.json")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func TestDial(t *testing.T) {
+	server := newHealthServer(t, 0)
+	defer server.Close()
+
+	m, err := Dial(context.Background(), WithHost(server.URL), WithWsHost("ws://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Symbol(context.Background(), "NVTNULS"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDial_ClockSkew(t *testing.T) {
+	server := newHealthServer(t, time.Minute)
+	defer server.Close()
+
+	_, err := Dial(context.Background(), WithHost(server.URL), WithWsHost("ws://127.0.0.1:1"), WithWebsocketCheck())
+	if !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("expected ErrClockSkew, got %v", err)
+	}
+	var initError *InitError
+	if !errors.As(err, &initError) || len(initError.Problems) != 1 {
+		t.Errorf("expected one problem, the websocket is skipped after a failure: %v", err)
+	}
+	// the market that failed the check is closed
+	signer, _ := NewKeySigner(testAddress, testPrivateKey)
+	_, err = Dial(context.Background(), WithHost(server.URL), WithWsHost("ws://127.0.0.1:1"), func(config *marketConfig) error {
+		config.market.setSigner(signer, true)
+		return nil
+	})
+	if !errors.Is(err, ErrClockSkew) {
+		t.Fatalf("expected ErrClockSkew, got %v", err)
+	}
+	if _, err := signer.Sign(make([]byte, 32)); !errors.Is(err, ErrSignerClosed) {
+		t.Errorf("the key survived a failed Dial: %v", err)
+	}
+	if _, err := Dial(context.Background(), WithHost(server.URL), WithMaxClockSkew(2*time.Minute)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDial_Websocket(t *testing.T) {
+	server := newHealthServer(t, 0)
+	defer server.Close()
+
+	_, err := Dial(context.Background(), WithHost(server.URL), WithWsHost("ws"+strings.TrimPrefix(server.URL, "http")), WithWebsocketCheck())
+	if err == nil || !strings.Contains(err.Error(), "websocket") {
+		t.Errorf("expected a websocket problem, got %v", err)
+	}
+}
+
+func TestInitialize_Problems(t *testing.T) {
+	m := &Market{Host: "api.nervedex.com", WsHost: "https://api.nervedex.com", Address: "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giE"}
+	err := m.Initialize()
+	var initError *InitError
+	if !errors.As(err, &initError) || len(initError.Problems) != 3 {
+		t.Fatalf("expected three problems, got %v", err)
+	}
+	if !errors.Is(err, address.ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+	if err := (&Market{}).Initialize(); err != nil {
+		t.Errorf("defaults rejected: %v", err)
+	}
+}
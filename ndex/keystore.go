@@ -0,0 +1,376 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/10 上午10:20
+ */
+package ndex
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/btcec"
+	cryptoutils "github.com/niels1286/nuls-go-sdk/crypto/utils"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// key derivation functions of a keystore
+const (
+	KDFScrypt	= "scrypt"
+	KDFPBKDF2	= "pbkdf2"
+	KDFLegacy	= "sha256"	// the NULS wallet format: aes-cbc with sha256(password) as key and a zero iv
+)
+
+const (
+	keystoreVersion		= 2
+	keystoreCipher		= "aes-256-gcm"
+	pbkdf2PRF			= "hmac-sha256"
+)
+
+// largest work factors accepted from a keystore file, scrypt needs 128 * n * r bytes so a crafted file could exhaust memory
+const (
+	maxScryptMemory		= 1 << 30
+	maxScryptP			= 16
+	maxPBKDF2Iterations	= 1 << 24
+)
+
+// work factors of new keystores, variables so tests can lower them
+var (
+	scryptN				= 1 << 18
+	scryptR				= 8
+	scryptP				= 1
+	pbkdf2Iterations	= 262144
+)
+
+/**
+ * Keystore is the encrypted private key of one account. Address, encryptedPrivateKey and pubkey are the fields of
+ * the NULS/Nerve wallet keystore; files without crypto are in that legacy format and are read as such.
+ * Keystore 为单个账户的加密私钥。address、encryptedPrivateKey、pubkey 与 NULS/Nerve 钱包的 keystore 一致，不含 crypto 的文件按旧格式读取。
+ */
+type Keystore struct {
+	Address				string			`json:"address"`
+	EncryptedPrivateKey	string			`json:"encryptedPrivateKey"`
+	Pubkey				string			`json:"pubkey"`
+	Version				int				`json:"version,omitempty"`
+	Crypto				*KeystoreCrypto	`json:"crypto,omitempty"`
+}
+
+type KeystoreCrypto struct {
+	Cipher		string		`json:"cipher"`
+	Nonce		string		`json:"nonce"`
+	KDF			string		`json:"kdf"`
+	KDFParams	KDFParams	`json:"kdfparams"`
+}
+
+type KDFParams struct {
+	Salt	string	`json:"salt"`
+	DKLen	int		`json:"dklen"`
+	N		int		`json:"n,omitempty"`		// scrypt
+	R		int		`json:"r,omitempty"`		// scrypt
+	P		int		`json:"p,omitempty"`		// scrypt
+	C		int		`json:"c,omitempty"`		// pbkdf2
+	PRF		string	`json:"prf,omitempty"`	// pbkdf2
+}
+
+/**
+ * Encrypt privateKey with password, kdf is KDFScrypt, KDFPBKDF2 or KDFLegacy for files the NULS wallet can import
+ * 使用密码加密私钥，kdf 可选 KDFScrypt、KDFPBKDF2，或 NULS 钱包可导入的 KDFLegacy
+ */
+func EncryptKeystore(address string, privateKey []byte, password, kdf string) (*Keystore, error) {
+	signer, err := NewKeySignerFromBytes(address, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer.Close()
+	if password == "" {
+		return nil, errors.New("password can not empty")
+	}
+	keystore := &Keystore{Address: address, Pubkey: hex.EncodeToString(signer.PublicKey())}
+	if kdf == KDFLegacy {
+		key := cryptoutils.Sha256h([]byte(password))
+		defer wipeBytes(key)
+		encrypted, err := legacyEncrypt(privateKey, key)
+		if err != nil {
+			return nil, err
+		}
+		keystore.EncryptedPrivateKey = hex.EncodeToString(encrypted)
+		return keystore, nil
+	}
+
+	salt := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	params := KDFParams{Salt: hex.EncodeToString(salt), DKLen: 32}
+	switch kdf {
+	case KDFScrypt:
+		params.N, params.R, params.P = scryptN, scryptR, scryptP
+	case KDFPBKDF2:
+		params.C, params.PRF = pbkdf2Iterations, pbkdf2PRF
+	default:
+		return nil, fmt.Errorf("unknown kdf %q", kdf)
+	}
+	keystore.Version = keystoreVersion
+	keystore.Crypto = &KeystoreCrypto{Cipher: keystoreCipher, Nonce: hex.EncodeToString(nonce), KDF: kdf, KDFParams: params}
+	key, err := keystore.deriveKey(password)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(key)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	// the address is authenticated with the key, a keystore can not be relabelled for another account
+	keystore.EncryptedPrivateKey = hex.EncodeToString(gcm.Seal(nil, nonce, privateKey, []byte(address)))
+	return keystore, nil
+}
+
+/**
+ * Decrypt the keystore into a KeySigner, a wrong password fails with ErrWrongPassword. Close the signer to wipe the key.
+ * 解密 keystore 得到 KeySigner，密码错误时返回 ErrWrongPassword。关闭签名器以清除私钥。
+ */
+func (keystore *Keystore) Unlock(password string) (*KeySigner, error) {
+	encrypted, err := hex.DecodeString(keystore.EncryptedPrivateKey)
+	if err != nil || len(encrypted) == 0 {
+		return nil, errors.New("keystore is broken")
+	}
+	var privateKey []byte
+	if keystore.Crypto == nil {
+		key := cryptoutils.Sha256h([]byte(password))
+		privateKey = legacyDecrypt(encrypted, key)
+		wipeBytes(key)
+		// a wrong password mostly fails the padding, otherwise it yields a key of another address
+		if len(privateKey) != 32 {
+			wipeBytes(privateKey)
+			return nil, ErrWrongPassword
+		}
+	} else {
+		if keystore.Crypto.Cipher != keystoreCipher {
+			return nil, fmt.Errorf("unknown keystore cipher %q", keystore.Crypto.Cipher)
+		}
+		nonce, err := hex.DecodeString(keystore.Crypto.Nonce)
+		if err != nil {
+			return nil, errors.New("keystore is broken")
+		}
+		key, err := keystore.deriveKey(password)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := newGCM(key)
+		wipeBytes(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(nonce) != gcm.NonceSize() {
+			return nil, errors.New("keystore is broken")
+		}
+		privateKey, err = gcm.Open(nil, nonce, encrypted, []byte(keystore.Address))
+		if err != nil {
+			return nil, ErrWrongPassword
+		}
+	}
+	defer wipeBytes(privateKey)
+	signer, err := NewKeySignerFromBytes(keystore.Address, privateKey)
+	if err != nil {
+		if keystore.Crypto == nil {
+			return nil, ErrWrongPassword
+		}
+		return nil, err
+	}
+	if keystore.Pubkey != "" && keystore.Pubkey != hex.EncodeToString(signer.PublicKey()) {
+		signer.Close()
+		return nil, fmt.Errorf("public key of keystore %s does not match its private key", keystore.Address)
+	}
+	return signer, nil
+}
+
+func (keystore *Keystore) deriveKey(password string) ([]byte, error) {
+	params := keystore.Crypto.KDFParams
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil || len(salt) == 0 || params.DKLen != 32 {
+		return nil, errors.New("keystore has invalid kdf parameters")
+	}
+	switch keystore.Crypto.KDF {
+	case KDFScrypt:
+		if params.N <= 1 || params.N&(params.N-1) != 0 || params.R <= 0 || params.P <= 0 || params.P > maxScryptP ||
+			params.N > maxScryptMemory/128/params.R {
+			return nil, fmt.Errorf("keystore has invalid scrypt parameters n=%d r=%d p=%d", params.N, params.R, params.P)
+		}
+		return scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	case KDFPBKDF2:
+		if params.PRF != pbkdf2PRF || params.C <= 0 || params.C > maxPBKDF2Iterations {
+			return nil, errors.New("keystore has invalid kdf parameters")
+		}
+		return pbkdf2.Key([]byte(password), salt, params.C, params.DKLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unknown kdf %q", keystore.Crypto.KDF)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aes-cbc with a zero iv and pkcs7 padding, as written by the NULS wallet
+func legacyEncrypt(plaintext, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := make([]byte, len(plaintext)+padding)
+	copy(padded, plaintext)
+	for i := len(plaintext); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+	defer wipeBytes(padded)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encrypted, padded)
+	return encrypted, nil
+}
+
+// nil on any padding error, the nuls-go-sdk helper panics on those
+func legacyDecrypt(encrypted, key []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil || len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil
+	}
+	plaintext := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plaintext, encrypted)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		wipeBytes(plaintext)
+		return nil
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			wipeBytes(plaintext)
+			return nil
+		}
+	}
+	return plaintext[:len(plaintext)-padding]
+}
+
+func ReadKeystore(reader io.Reader) (*Keystore, error) {
+	keystore := &Keystore{}
+	if err := json.NewDecoder(reader).Decode(keystore); err != nil {
+		return nil, fmt.Errorf("problem parsing keystore, %v", err)
+	}
+	if keystore.Address == "" || keystore.EncryptedPrivateKey == "" {
+		return nil, errors.New("keystore is broken")
+	}
+	return keystore, nil
+}
+
+func LoadKeystore(path string) (*Keystore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadKeystore(file)
+}
+
+/**
+ * Write the keystore to path with mode 0600, the file is replaced atomically
+ * 以 0600 权限将 keystore 写入 path，文件以原子方式替换
+ */
+func (keystore *Keystore) Save(path string) error {
+	data, err := json.MarshalIndent(keystore, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+/**
+ * Load the keystore at path and sign with it, the market address is taken from the keystore. The unlocked key is
+ * wiped by Market.Close, or right away when NewMarket fails
+ * 加载 path 处的 keystore 并用其签名，Market 的地址取自 keystore。解锁的私钥由 Market.Close 清除，NewMarket 失败时立即清除
+ */
+func WithKeystore(path, password string) Option {
+	return func(config *marketConfig) error {
+		keystore, err := LoadKeystore(path)
+		if err != nil {
+			return err
+		}
+		signer, err := keystore.Unlock(password)
+		if err != nil {
+			return fmt.Errorf("unlock keystore %s: %w", keystore.Address, err)
+		}
+		config.market.setSigner(signer, true)
+		return nil
+	}
+}
+
+/**
+ * Check that publicKey belongs to address, the chain id is taken from the address
+ * 校验公钥是否属于该地址，链ID取自地址
+ */
+func CheckAddress(address string, publicKey []byte) error {
+	if _, err := btcec.ParsePubKey(publicKey, btcec.S256()); err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if !addressMatchesKey(address, publicKey) {
+		return fmt.Errorf("address %s does not belong to public key %x", address, publicKey)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/10 下午3:30
+ */
+package ndex
+
+import (
+	"context"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/niels1286/nuls-go-sdk/account"
+)
+
+func init() {
+	// the production work factors take seconds per keystore
+	scryptN = 1 << 10
+	pbkdf2Iterations = 1000
+}
+
+func tempKeystorePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ndex-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "keystore.json")
+}
+
+func TestKeystore_RoundTrip(t *testing.T) {
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	for _, kdf := range []string{KDFScrypt, KDFPBKDF2, KDFLegacy} {
+		keystore, err := EncryptKeystore(testAddress, privateKey, "nerve123456", kdf)
+		if err != nil {
+			t.Fatalf("%s: %v", kdf, err)
+		}
+		path := tempKeystorePath(t)
+		defer os.RemoveAll(filepath.Dir(path))
+		if err := keystore.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: keystore file mode %v, %v", kdf, info.Mode(), err)
+		}
+		loaded, err := LoadKeystore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loaded.Unlock("wrong123456"); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%s: expected ErrWrongPassword, got %v", kdf, err)
+		}
+		signer, err := loaded.Unlock("nerve123456")
+		if err != nil {
+			t.Fatalf("%s: %v", kdf, err)
+		}
+		if signer.Address() != testAddress {
+			t.Errorf("%s: address %s", kdf, signer.Address())
+		}
+		if _, err := signer.Sign(make([]byte, 32)); err != nil {
+			t.Error(err)
+		}
+		signer.Close()
+		if _, err := signer.Sign(make([]byte, 32)); !errors.Is(err, ErrSignerClosed) {
+			t.Errorf("%s: signing after Close returned %v", kdf, err)
+		}
+	}
+}
+
+func TestKeystore_NulsCompatible(t *testing.T) {
+	nulsAccount, _ := account.GetAccountFromPrkey(testPrivateKey, 5, "TNVT")
+	nulsKeystore, _ := account.CreateKeyStore(nulsAccount, "nerve123456")
+	data, _ := json.Marshal(nulsKeystore)
+	keystore, err := ReadKeystore(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := keystore.Unlock("nerve123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address() != nulsAccount.Address {
+		t.Errorf("address %s, want %s", signer.Address(), nulsAccount.Address)
+	}
+
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	legacy, _ := EncryptKeystore(testAddress, privateKey, "nerve123456", KDFLegacy)
+	restored, err := account.KeyStore{EncryptedPrivateKey: legacy.EncryptedPrivateKey}.GetAccount("nerve123456", 5, "TNVT")
+	if err != nil || restored.Address != testAddress {
+		t.Errorf("the NULS wallet restored %v, %v", restored, err)
+	}
+}
+
+func TestKeystore_Tampered(t *testing.T) {
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	keystore, _ := EncryptKeystore(testAddress, privateKey, "nerve123456", KDFScrypt)
+	keystore.Address = "TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA"
+	if _, err := keystore.Unlock("nerve123456"); err == nil {
+		t.Error("a relabelled keystore was unlocked")
+	}
+	if _, err := EncryptKeystore("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA", privateKey, "nerve123456", KDFScrypt); err == nil {
+		t.Error("a key was stored under another address")
+	}
+}
+
+func TestKeystore_WorkFactorBounds(t *testing.T) {
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	crafted := map[string]func(*KDFParams){
+		"huge n": func(p *KDFParams) { p.N = 1 << 30 },
+		"n not a power of two": func(p *KDFParams) { p.N = 1000 },
+		"huge r": func(p *KDFParams) { p.R = 1 << 20 },
+		"huge p": func(p *KDFParams) { p.P = 1 << 20 },
+		"zero r": func(p *KDFParams) { p.R = 0 },
+	}
+	for name, craft := range crafted {
+		keystore, _ := EncryptKeystore(testAddress, privateKey, "nerve123456", KDFScrypt)
+		craft(&keystore.Crypto.KDFParams)
+		if _, err := keystore.Unlock("nerve123456"); err == nil || errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+	keystore, _ := EncryptKeystore(testAddress, privateKey, "nerve123456", KDFPBKDF2)
+	keystore.Crypto.KDFParams.C = 1 << 30
+	if _, err := keystore.Unlock("nerve123456"); err == nil || errors.Is(err, ErrWrongPassword) {
+		t.Errorf("huge pbkdf2 iteration count: got %v", err)
+	}
+}
+
+func TestNewMarket_Keystore(t *testing.T) {
+	privateKey, _ := hex.DecodeString(testPrivateKey)
+	keystore, _ := EncryptKeystore(testAddress, privateKey, "nerve123456", KDFPBKDF2)
+	path := tempKeystorePath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	keystore.Save(path)
+
+	m, err := NewMarket(WithNetwork(Beta()), WithKeystore(path, "nerve123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Address != testAddress || m.PrivateKey != "" {
+		t.Errorf("address %s, private key %q", m.Address, m.PrivateKey)
+	}
+	if _, err := NewMarket(WithKeystore(path, "wrong123456")); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected ErrWrongPassword, got %v", err)
+	}
+	if _, err := NewMarket(WithAddress("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA"), WithPrivateKey(testPrivateKey)); err == nil {
+		t.Error("a private key of another address was accepted")
+	}
+
+	// the unlocked key is wiped by Close
+	keyWords := m.signer.(*KeySigner).privateKey.D.Bits()
+	if err := m.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !wiped(keyWords) {
+		t.Error("the keystore key survived Close")
+	}
+	if _, err := m.signer.Sign(make([]byte, 32)); !errors.Is(err, ErrSignerClosed) {
+		t.Errorf("signed after Close: %v", err)
+	}
+	// and when a later option fails
+	var unlocked *KeySigner
+	_, err = NewMarket(WithKeystore(path, "nerve123456"), func(config *marketConfig) error {
+		unlocked = config.market.signer.(*KeySigner)
+		return errors.New("later option failed")
+	})
+	if err == nil || unlocked == nil || unlocked.privateKey != nil {
+		t.Errorf("the keystore key survived a failed NewMarket: %v", err)
+	}
+	// a signer of the caller is left alone
+	signer, _ := NewKeySigner(testAddress, testPrivateKey)
+	m, _ = NewMarket(WithNetwork(Beta()), WithSigner(signer))
+	m.Close(context.Background())
+	if _, err := signer.Sign(make([]byte, 32)); err != nil {
+		t.Errorf("Close wiped the signer of the caller: %v", err)
+	}
+
+	if CheckAddress(testAddress, signer.PublicKey()) != nil || CheckAddress("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA", signer.PublicKey()) == nil {
+		t.Error("unexpected CheckAddress result")
+	}
+}
+
+func wiped(words []big.Word) bool {
+	for _, word := range words {
+		if word != 0 {
+			return false
+		}
+	}
+	return len(words) > 0
+}
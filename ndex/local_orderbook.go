@@ -0,0 +1,465 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/28 上午11:05
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * WatchOrderBook reloads the book over rest when no update arrived for this long
+ * WatchOrderBook 在这段时间内未收到更新时通过 rest 重新加载盘口
+ */
+const DefaultOrderBookStaleAfter = 30 * time.Second
+
+var decimalHalf = NewDecimal(5, 1)
+
+type PriceLevel struct {
+	Price	Decimal
+	Amount	Decimal
+}
+
+/**
+ * Result of sweeping the book with a market order
+ * 使用市价单吃掉盘口的结果
+ */
+type Sweep struct {
+	Filled	Decimal		// base amount taken from the book
+	Quote	Decimal		// quote amount paid or received, sum of price * amount
+	Worst	Decimal		// price of the last level touched
+	Levels	int
+}
+
+/**
+ * An order book kept up to date from websocket snapshots, safe for concurrent use. Asks are sorted by ascending
+ * and bids by descending price, a snapshot older than the book is rejected
+ * 根据 websocket 快照保持最新的盘口，可并发使用。卖单按价格升序、买单按价格降序排列，早于当前盘口的快照会被拒绝
+ */
+type LocalOrderBook struct {
+	Symbol		string
+
+	mu			sync.RWMutex
+	asks		[]PriceLevel
+	bids		[]PriceLevel
+	updateTime	int64
+	receivedAt	time.Time
+	synced		bool
+	resyncs		int
+}
+
+func NewLocalOrderBook(symbol string) *LocalOrderBook {
+	return &LocalOrderBook{Symbol: symbol}
+}
+
+/**
+ * Replace the book with a websocket snapshot, ErrStaleOrderBook if it is older than the book. A resync marker only
+ * marks the book as out of sync until the next snapshot
+ * 使用 websocket 快照替换盘口，快照早于当前盘口时返回 ErrStaleOrderBook。重新同步标记只会将盘口标记为未同步，直到下一个快照到达
+ */
+func (book *LocalOrderBook) Apply(snapshot *OrderBook) error {
+	if snapshot.Resync {
+		book.invalidate()
+		return nil
+	}
+	return book.replace(snapshot, false)
+}
+
+/**
+ * Replace the book with a rest snapshot whatever its update time, later websocket snapshots must not be older
+ * 无论更新时间如何都使用 rest 快照替换盘口，之后的 websocket 快照不能早于它
+ */
+func (book *LocalOrderBook) Reset(snapshot *OrderBook) error {
+	return book.replace(snapshot, true)
+}
+
+func (book *LocalOrderBook) replace(snapshot *OrderBook, reset bool) error {
+	if snapshot.Symbol != book.Symbol {
+		return fmt.Errorf("order book of %s applied to %s", snapshot.Symbol, book.Symbol)
+	}
+	asks, err := parseLevels(snapshot.SellList)
+	if err != nil {
+		return fmt.Errorf("sell list of %s: %w", book.Symbol, err)
+	}
+	bids, err := parseLevels(snapshot.BuyList)
+	if err != nil {
+		return fmt.Errorf("buy list of %s: %w", book.Symbol, err)
+	}
+	sort.SliceStable(asks, func(i, j int) bool { return asks[i].Price.LessThan(asks[j].Price) })
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].Price.GreaterThan(bids[j].Price) })
+
+	book.mu.Lock()
+	defer book.mu.Unlock()
+	if !reset && snapshot.UpdateTime < book.updateTime {
+		return fmt.Errorf("%w: %s at %d, book at %d", ErrStaleOrderBook, book.Symbol, snapshot.UpdateTime, book.updateTime)
+	}
+	if reset {
+		book.resyncs++
+	}
+	book.asks, book.bids = asks, bids
+	book.updateTime = snapshot.UpdateTime
+	book.receivedAt = time.Now()
+	book.synced = true
+	return nil
+}
+
+// [price, amount] pairs, levels without amount are dropped
+func parseLevels(list [][]Decimal) ([]PriceLevel, error) {
+	levels := make([]PriceLevel, 0, len(list))
+	for _, entry := range list {
+		if len(entry) < 2 {
+			return nil, fmt.Errorf("level %v is not a [price, amount] pair", entry)
+		}
+		if entry[0].Sign() <= 0 || entry[1].Sign() < 0 {
+			return nil, fmt.Errorf("level %v has a non-positive price or a negative amount", entry)
+		}
+		if entry[1].IsZero() {
+			continue
+		}
+		levels = append(levels, PriceLevel{Price: entry[0], Amount: entry[1]})
+	}
+	return levels, nil
+}
+
+func (book *LocalOrderBook) invalidate() {
+	book.mu.Lock()
+	defer book.mu.Unlock()
+	book.synced = false
+}
+
+/**
+ * Whether the book reflects the server, false before the first snapshot and after a reconnect or gap until it is reloaded
+ * 盘口是否与服务器一致，在首个快照之前，以及重连或中断后重新加载之前为 false
+ */
+func (book *LocalOrderBook) Synced() bool {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	return book.synced
+}
+
+// server time of the snapshot in the book
+func (book *LocalOrderBook) UpdatedAt() time.Time {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	return fromMillis(book.updateTime)
+}
+
+// local time the snapshot in the book was applied
+func (book *LocalOrderBook) ReceivedAt() time.Time {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	return book.receivedAt
+}
+
+// how many times the book was reloaded over rest
+func (book *LocalOrderBook) Resyncs() int {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	return book.resyncs
+}
+
+// copies of the asks and bids, best price first
+func (book *LocalOrderBook) Levels() (asks, bids []PriceLevel) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	return append([]PriceLevel(nil), book.asks...), append([]PriceLevel(nil), book.bids...)
+}
+
+func (book *LocalOrderBook) BestBid() (PriceLevel, bool) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	if len(book.bids) == 0 {
+		return PriceLevel{}, false
+	}
+	return book.bids[0], true
+}
+
+func (book *LocalOrderBook) BestAsk() (PriceLevel, bool) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	if len(book.asks) == 0 {
+		return PriceLevel{}, false
+	}
+	return book.asks[0], true
+}
+
+// best ask minus best bid, false unless both sides have orders
+func (book *LocalOrderBook) Spread() (Decimal, bool) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	if len(book.asks) == 0 || len(book.bids) == 0 {
+		return Decimal{}, false
+	}
+	return book.asks[0].Price.Sub(book.bids[0].Price), true
+}
+
+// halfway between the best bid and ask, false unless both sides have orders
+func (book *LocalOrderBook) Mid() (Decimal, bool) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	if len(book.asks) == 0 || len(book.bids) == 0 {
+		return Decimal{}, false
+	}
+	return book.asks[0].Price.Add(book.bids[0].Price).Mul(decimalHalf), true
+}
+
+// the levels a taker order of side trades against
+func (book *LocalOrderBook) takerLevels(side Side) ([]PriceLevel, error) {
+	switch side {
+	case SideBuy:
+		return book.asks, nil
+	case SideSell:
+		return book.bids, nil
+	}
+	return nil, fmt.Errorf("invalid side %s", side)
+}
+
+/**
+ * Amount a taker order of side can fill at price or better, a buy counts the asks up to price and a sell the bids down to it
+ * side 方向的吃单在 price 或更优价格可成交的数量，买单统计不高于 price 的卖单，卖单统计不低于 price 的买单
+ */
+func (book *LocalOrderBook) DepthAt(side Side, price Decimal) (Decimal, error) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	levels, err := book.takerLevels(side)
+	if err != nil {
+		return Decimal{}, err
+	}
+	depth := NewDecimalFromInt(0)
+	for _, level := range levels {
+		if side == SideBuy && level.Price.GreaterThan(price) || side == SideSell && level.Price.LessThan(price) {
+			break
+		}
+		depth = depth.Add(level.Amount)
+	}
+	return depth, nil
+}
+
+/**
+ * Walk the book as a market order of side for amount would, ErrInsufficientDepth with the partial sweep if the book runs out
+ * 模拟数量为 amount 的 side 方向市价单吃掉盘口，盘口深度不足时返回部分结果及 ErrInsufficientDepth
+ */
+func (book *LocalOrderBook) Sweep(side Side, amount Decimal) (Sweep, error) {
+	book.mu.RLock()
+	defer book.mu.RUnlock()
+	levels, err := book.takerLevels(side)
+	if err != nil {
+		return Sweep{}, err
+	}
+	if amount.Sign() <= 0 {
+		return Sweep{}, errors.New("sweep amount must be positive")
+	}
+	sweep := Sweep{Filled: NewDecimalFromInt(0), Quote: NewDecimalFromInt(0)}
+	for _, level := range levels {
+		take := level.Amount
+		if remaining := amount.Sub(sweep.Filled); take.GreaterThan(remaining) {
+			take = remaining
+		}
+		sweep.Filled = sweep.Filled.Add(take)
+		sweep.Quote = sweep.Quote.Add(take.Mul(level.Price))
+		sweep.Worst = level.Price
+		sweep.Levels++
+		if sweep.Filled.Equal(amount) {
+			return sweep, nil
+		}
+	}
+	return sweep, fmt.Errorf("%w: %s of %s available to %s", ErrInsufficientDepth, sweep.Filled, amount, side)
+}
+
+/**
+ * Volume weighted average price of a market order of side for amount, rounded to places fractional digits
+ * 数量为 amount 的 side 方向市价单的成交量加权平均价，保留 places 位小数
+ */
+func (book *LocalOrderBook) VWAP(side Side, amount Decimal, places int32) (Decimal, error) {
+	sweep, err := book.Sweep(side, amount)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return sweep.Quote.Div(sweep.Filled, places)
+}
+
+/**
+ * Keep a LocalOrderBook of symbol with the top levels of each side. The book is loaded over rest, updated from the
+ * websocket, and reloaded after a reconnect or when no update arrived for DefaultOrderBookStaleAfter. It is watched
+ * until ctx is done or the market is closed; a symbol that is already watched returns the same book. The websocket
+ * channel of the symbol belongs to the watcher, do not subscribe to it separately
+ * 维护 symbol 的 LocalOrderBook，每边保留 top 档。盘口先通过 rest 加载，之后由 websocket 更新，重连后或在
+ * DefaultOrderBookStaleAfter 内未收到更新时重新加载。维护持续到 ctx 结束或 Market 关闭；已在维护的交易对返回同一个盘口。
+ * 该交易对的 websocket 频道归维护者所有，请勿另行订阅
+ */
+func (market *Market) WatchOrderBook(ctx context.Context, symbol string, top int) (*LocalOrderBook, error) {
+	market.backgroundMu.Lock()
+	if book := market.orderBooks[symbol]; book != nil {
+		market.backgroundMu.Unlock()
+		return book, nil
+	}
+	// concurrent calls for one symbol share the websocket channel, count them so a failing one leaves it alone
+	if market.orderBookStarts == nil {
+		market.orderBookStarts = map[string]int{}
+	}
+	market.orderBookStarts[symbol]++
+	market.backgroundMu.Unlock()
+
+	// subscribe first, so nothing is missed between the rest snapshot and the first update
+	events, err := market.SubscribeOrderBookCtx(ctx, symbol, top)
+	if err == nil {
+		book := NewLocalOrderBook(symbol)
+		if err = market.reloadOrderBook(ctx, book, top); err == nil {
+			return market.startOrderBookWatch(ctx, book, events, top), nil
+		}
+	}
+	market.backgroundMu.Lock()
+	market.orderBookStartDone(symbol)
+	shared := market.orderBooks[symbol] != nil || market.orderBookStarts[symbol] > 0
+	market.backgroundMu.Unlock()
+	if !shared {
+		market.unsubscribeOrderBook(symbol)
+	}
+	return nil, err
+}
+
+// callers hold backgroundMu
+func (market *Market) orderBookStartDone(symbol string) {
+	market.orderBookStarts[symbol]--
+	if market.orderBookStarts[symbol] == 0 {
+		delete(market.orderBookStarts, symbol)
+	}
+}
+
+// register book and start its watcher, unless a concurrent call registered one first
+func (market *Market) startOrderBookWatch(ctx context.Context, book *LocalOrderBook, events chan *OrderBook, top int) *LocalOrderBook {
+	symbol := book.Symbol
+	market.backgroundMu.Lock()
+	market.orderBookStartDone(symbol)
+	if existing := market.orderBooks[symbol]; existing != nil {
+		// watched concurrently, both calls share the channel so keep the first watcher
+		market.backgroundMu.Unlock()
+		return existing
+	}
+	if market.orderBooks == nil {
+		market.orderBooks = map[string]*LocalOrderBook{}
+	}
+	market.orderBooks[symbol] = book
+	market.backgroundMu.Unlock()
+
+	staleAfter := market.orderBookStaleAfter
+	if staleAfter <= 0 {
+		staleAfter = DefaultOrderBookStaleAfter
+	}
+	market.goBackground(ctx, func(ctx context.Context) {
+		market.watchOrderBook(ctx, book, events, top, staleAfter)
+	})
+	return book
+}
+
+func (market *Market) watchOrderBook(ctx context.Context, book *LocalOrderBook, events chan *OrderBook, top int, staleAfter time.Duration) {
+	defer func() {
+		market.backgroundMu.Lock()
+		delete(market.orderBooks, book.Symbol)
+		market.backgroundMu.Unlock()
+		book.invalidate()
+	}()
+	timer := time.NewTimer(staleAfter)
+	defer timer.Stop()
+	for {
+		select {
+		case snapshot, ok := <-events:
+			if !ok {
+				// the websocket was closed
+				return
+			}
+			if snapshot.Resync {
+				book.invalidate()
+				market.resyncOrderBook(ctx, book, top)
+			} else if err := book.Apply(snapshot); err != nil && !errors.Is(err, ErrStaleOrderBook) {
+				log.Println("ndex order book error : ", err)
+			}
+		case <-timer.C:
+			// a gap in the updates, the book may be out of date
+			book.invalidate()
+			market.resyncOrderBook(ctx, book, top)
+		case <-ctx.Done():
+			market.unsubscribeOrderBook(book.Symbol)
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(staleAfter)
+	}
+}
+
+func (market *Market) reloadOrderBook(ctx context.Context, book *LocalOrderBook, top int) error {
+	snapshot, err := market.GetOrderBookCtx(ctx, book.Symbol, top)
+	if err != nil {
+		return err
+	}
+	return book.Reset(snapshot)
+}
+
+// a failed reload is retried after the next gap, the book stays out of sync until then
+func (market *Market) resyncOrderBook(ctx context.Context, book *LocalOrderBook, top int) {
+	if err := market.reloadOrderBook(ctx, book, top); err != nil && ctx.Err() == nil {
+		log.Println("ndex order book resync error : ", err)
+	}
+}
+
+func (market *Market) unsubscribeOrderBook(symbol string) {
+	market.wsMu.Lock()
+	ndexWs := market.ndexWs
+	market.wsMu.Unlock()
+	if ndexWs == nil {
+		return
+	}
+	if err := ndexWs.UnSubscribeOrderBook(symbol); err != nil && !errors.Is(err, ErrWsClosed) {
+		log.Println("ndex order book unsubscribe error : ", err)
+	}
+}
+
+/**
+ * Reload a watched order book over rest when no update arrived for staleAfter
+ * 被维护的盘口在 staleAfter 内未收到更新时通过 rest 重新加载
+ */
+func WithOrderBookStaleAfter(staleAfter time.Duration) Option {
+	return func(config *marketConfig) error {
+		if staleAfter <= 0 {
+			return errors.New("order book stale duration must be positive")
+		}
+		config.market.orderBookStaleAfter = staleAfter
+		return nil
+	}
+}
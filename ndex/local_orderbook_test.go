@@ -0,0 +1,292 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/28 上午11:05
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func levels(pairs ...string) [][]Decimal {
+	list := make([][]Decimal, 0, len(pairs) / 2)
+	for i := 0; i + 1 < len(pairs); i += 2 {
+		list = append(list, []Decimal{MustParseDecimal(pairs[i]), MustParseDecimal(pairs[i + 1])})
+	}
+	return list
+}
+
+func testLocalOrderBook(t *testing.T) *LocalOrderBook {
+	book := NewLocalOrderBook("NVTNULS")
+	err := book.Apply(&OrderBook{
+		Symbol:		"NVTNULS",
+		UpdateTime:	1589271331877,
+		SellList:	levels("0.045", "350.5", "0.0449", "1200", "0.0452", "0"),
+		BuyList:	levels("0.0445", "2310.75", "0.0446", "800"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func TestLocalOrderBook_Apply(t *testing.T) {
+	book := testLocalOrderBook(t)
+	if !book.Synced() || book.UpdatedAt().UnixNano() / 1e6 != 1589271331877 {
+		t.Errorf("synced %v at %s", book.Synced(), book.UpdatedAt())
+	}
+	asks, bids := book.Levels()
+	if len(asks) != 2 || asks[0].Price.String() != "0.0449" || asks[1].Price.String() != "0.045" {
+		t.Errorf("asks %v", asks)
+	}
+	if len(bids) != 2 || bids[0].Price.String() != "0.0446" || bids[1].Price.String() != "0.0445" {
+		t.Errorf("bids %v", bids)
+	}
+
+	older := &OrderBook{Symbol: "NVTNULS", UpdateTime: 1589271331000, SellList: levels("1", "1")}
+	if err := book.Apply(older); !errors.Is(err, ErrStaleOrderBook) {
+		t.Errorf("expected ErrStaleOrderBook, got %v", err)
+	}
+	if ask, _ := book.BestAsk(); ask.Price.String() != "0.0449" {
+		t.Errorf("older snapshot was applied, best ask %s", ask.Price)
+	}
+	if err := book.Apply(&OrderBook{Symbol: "NVTUSDT", UpdateTime: 1589271332000}); err == nil {
+		t.Error("snapshot of another symbol was applied")
+	}
+	if err := book.Apply(&OrderBook{Symbol: "NVTNULS", UpdateTime: 1589271332000, BuyList: [][]Decimal{{MustParseDecimal("1")}}}); err == nil {
+		t.Error("level without amount was applied")
+	}
+
+	// a resync marker leaves the levels but marks the book until the next snapshot
+	book.Apply(&OrderBook{Symbol: "NVTNULS", Resync: true})
+	if book.Synced() {
+		t.Error("synced after a resync marker")
+	}
+	if err := book.Reset(older); err != nil || !book.Synced() || book.Resyncs() != 1 {
+		t.Errorf("reset: %v, synced %v, %d resyncs", err, book.Synced(), book.Resyncs())
+	}
+}
+
+func TestLocalOrderBook_Queries(t *testing.T) {
+	book := testLocalOrderBook(t)
+	if bid, ok := book.BestBid(); !ok || bid.Amount.String() != "800" {
+		t.Errorf("best bid %v %v", bid, ok)
+	}
+	if spread, ok := book.Spread(); !ok || spread.String() != "0.0003" {
+		t.Errorf("spread %s %v", spread, ok)
+	}
+	if mid, ok := book.Mid(); !ok || !mid.Equal(MustParseDecimal("0.04475")) {
+		t.Errorf("mid %s %v", mid, ok)
+	}
+	depthTests := []struct {
+		side	Side
+		price	string
+		depth	string
+	}{
+		{SideBuy, "0.0448", "0"},
+		{SideBuy, "0.0449", "1200"},
+		{SideBuy, "1", "1550.5"},
+		{SideSell, "0.0446", "800"},
+		{SideSell, "0.04455", "800"},
+		{SideSell, "0", "3110.75"},
+	}
+	for _, test := range depthTests {
+		depth, err := book.DepthAt(test.side, MustParseDecimal(test.price))
+		if err != nil || !depth.Equal(MustParseDecimal(test.depth)) {
+			t.Errorf("%s depth at %s: %s %v, expected %s", test.side, test.price, depth, err, test.depth)
+		}
+	}
+
+	// 1200 * 0.0449 + 300 * 0.045 = 67.38
+	sweep, err := book.Sweep(SideBuy, MustParseDecimal("1500"))
+	if err != nil || !sweep.Quote.Equal(MustParseDecimal("67.38")) || sweep.Levels != 2 || sweep.Worst.String() != "0.045" {
+		t.Errorf("sweep %+v %v", sweep, err)
+	}
+	if vwap, err := book.VWAP(SideBuy, MustParseDecimal("1500"), 6); err != nil || !vwap.Equal(MustParseDecimal("0.04492")) {
+		t.Errorf("vwap %s %v", vwap, err)
+	}
+	if vwap, err := book.VWAP(SideSell, MustParseDecimal("400"), 4); err != nil || vwap.String() != "0.0446" {
+		t.Errorf("vwap %s %v", vwap, err)
+	}
+	sweep, err = book.Sweep(SideSell, MustParseDecimal("5000"))
+	if !errors.Is(err, ErrInsufficientDepth) || !sweep.Filled.Equal(MustParseDecimal("3110.75")) {
+		t.Errorf("sweep beyond the book %+v %v", sweep, err)
+	}
+
+	empty := NewLocalOrderBook("NVTNULS")
+	if _, ok := empty.Mid(); ok {
+		t.Error("mid of an empty book")
+	}
+	if _, err := empty.VWAP(SideBuy, MustParseDecimal("1"), 4); !errors.Is(err, ErrInsufficientDepth) {
+		t.Errorf("vwap of an empty book %v", err)
+	}
+}
+
+// serves /api/orderBook/S0/10 and counts the requests
+func orderBookServer(t *testing.T, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/orderBook/S0/10" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(requests, 1)
+		fmt.Fprint(w, `{"code":0,"success":true,"msg":"success","data":{"symbol":"S0","updateTime":0,"sellList":[[2,1]],"buyList":[[1,1]]}}`)
+	}))
+}
+
+// wait until cond holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMarket_WatchOrderBook(t *testing.T) {
+	var requests int32
+	server := orderBookServer(t, &requests)
+	defer server.Close()
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+	baseline := runtime.NumGoroutine()
+
+	m, err := NewMarket(WithHost(server.URL), WithWsHost(standIn.wsHost()), WithWsReconnect(*testReconnectBackoff, 0),
+		WithOrderBookStaleAfter(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	book, err := m.WatchOrderBook(context.Background(), "S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.WatchOrderBook(context.Background(), "S0", 10); again != book {
+		t.Error("a watched symbol returned another book")
+	}
+	// the stand-in sends empty books with a growing update time
+	waitFor(t, "a websocket update", func() bool {
+		_, ok := book.BestAsk()
+		return !ok && book.UpdatedAt().UnixNano() > 0
+	})
+
+	// reloaded after a reconnect
+	standIn.dropAll()
+	waitFor(t, "a reload after the reconnect", func() bool { return atomic.LoadInt32(&requests) >= 2 })
+
+	// and after a gap
+	atomic.StoreInt32(&standIn.mute, 1)
+	reloads := atomic.LoadInt32(&requests)
+	waitFor(t, "a reload after a gap", func() bool {
+		ask, ok := book.BestAsk()
+		return atomic.LoadInt32(&requests) > reloads && book.Synced() && ok && ask.Price.String() == "2"
+	})
+	atomic.StoreInt32(&standIn.mute, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if book.Synced() {
+		t.Error("synced after the market was closed")
+	}
+	waitGoroutines(t, baseline)
+}
+
+func TestMarket_WatchOrderBookStop(t *testing.T) {
+	var requests int32
+	server := orderBookServer(t, &requests)
+	defer server.Close()
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithWsHost(standIn.wsHost()))
+	defer m.Close(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	book, err := m.WatchOrderBook(ctx, "S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitMessages(t, standIn, `{"action":"Unsubscribe"`, 1)
+	waitFor(t, "the watcher to stop", func() bool { return !book.Synced() })
+	if again, err := m.WatchOrderBook(context.Background(), "S0", 10); err != nil || again == book {
+		t.Errorf("watching again returned the stopped book: %v", err)
+	}
+}
+
+func TestMarket_WatchOrderBookRace(t *testing.T) {
+	// the first rest load waits for the second watcher and then fails
+	var requests int32
+	first, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(first)
+			<-release
+			fmt.Fprint(w, `{"code":1,"success":false,"msg":"failed"}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":0,"success":true,"msg":"success","data":{"symbol":"S0","updateTime":0,"sellList":[[2,1]],"buyList":[[1,1]]}}`)
+	}))
+	defer server.Close()
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithWsHost(standIn.wsHost()))
+	defer m.Close(context.Background())
+	failed := make(chan error, 1)
+	go func() {
+		_, err := m.WatchOrderBook(context.Background(), "S0", 10)
+		failed <- err
+	}()
+	<-first
+	book, err := m.WatchOrderBook(context.Background(), "S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-failed; err == nil {
+		t.Fatal("the failed load returned no error")
+	}
+
+	// the failed call left the channel of the running watcher alone
+	updated := book.UpdatedAt()
+	waitFor(t, "a websocket update", func() bool { return book.UpdatedAt().After(updated) })
+	if n := len(standIn.messages(`{"action":"Unsubscribe"`)); n != 0 {
+		t.Fatalf("unsubscribed %d times", n)
+	}
+}
@@ -29,17 +29,19 @@ Copyright (c) 2019-2020 nerve.network
 package ndex
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/niels1286/nuls-go-sdk/crypto/eckey"
 	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
-	"github.com/niels1286/nuls-go-sdk/utils/seria"
-	"log"
+	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/NerveNetwork/ndex-go-sdk/utils"
+	"github.com/gorilla/websocket"
 )
 
 type Market struct {
@@ -48,20 +50,166 @@ type Market struct {
 	Address 	string
 	PrivateKey	string
 
+	client		*utils.Client
+	retryPolicy	*RetryPolicy
+	limiters	map[EndpointClass]*utils.RateLimiter
+	strictDecoding	bool
+	wsDialer	*websocket.Dialer
+	wsHeader	http.Header
 	ndexWs		*NdexWs
+	wsMu		sync.Mutex
+	wsReconnectBackoff	*utils.Backoff
+	wsMaxReconnectAttempts	int
+	wsPingInterval	time.Duration
+	wsMaxMissedPongs	int
+	symbols		symbolCache
+	signer		Signer
+	signerOwned	bool		// the signer was unlocked by WithKeystore, Close wipes it
+	txPolicies	[]TxPolicy
+	localTxBuilding	bool
+	feeAddress	string
+	feeScale	byte
+	nonces		nonceCache
+	maxClockSkew	time.Duration
+	websocketCheck	bool
+	network		*Network
+	clock		ClockSync
+	backgroundMu	sync.Mutex
+	backgroundStops	[]context.CancelFunc
+	background	sync.WaitGroup		// clock syncs and order book watchers, stopped by Close
+	orderBooks	map[string]*LocalOrderBook
+	orderBookStarts	map[string]int		// WatchOrderBook calls still loading their book
+	orderBookStaleAfter	time.Duration
+	fanOutConcurrency	int
 }
 
 /**
- * Perform basic testing and set the default server access address
- * 进行基本的检测，设置默认的服务器访问地址
+ * Set the default server access address and check the configuration, the returned *InitError lists every problem found
+ * 设置默认的服务器访问地址并检查配置，返回的 *InitError 列出发现的所有问题
  */
-func (market *Market) Initialize() {
+func (market *Market) Initialize() error {
+	problems := market.applyNetwork()
 	if market.Host == "" {
-		market.Host = "https://api.nervedex.com"
+		market.Host = mainnet.Host
 	}
 	if market.WsHost == "" {
-		market.WsHost = "wss://api.nervedex.com"
+		market.WsHost = mainnet.WsHost
 	}
+	if err := checkHostURL(market.Host, "http", "https"); err != nil {
+		problems = append(problems, fmt.Errorf("host: %w", err))
+	}
+	if err := checkHostURL(market.WsHost, "ws", "wss"); err != nil {
+		problems = append(problems, fmt.Errorf("websocket host: %w", err))
+	}
+	// a typo in the address would silently query another account
+	if err := market.checkAccount(); err != nil {
+		problems = append(problems, fmt.Errorf("account: %w", err))
+	}
+	return newInitError(problems)
+}
+
+func checkHostURL(host string, schemes ...string) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", host)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must use one of the schemes %v", host, schemes)
+}
+
+// the configured address must be well-formed and belong to the configured private key
+func (market *Market) checkAccount() error {
+	if market.Address == "" {
+		return nil
+	}
+	if err := market.validateAddress(market.Address); err != nil {
+		return err
+	}
+	if market.PrivateKey == "" {
+		return nil
+	}
+	signer, err := NewKeySigner(market.Address, market.PrivateKey)
+	if err != nil {
+		return err
+	}
+	// only built to check the key, it is wiped right away
+	return signer.Close()
+}
+
+// A Market built as a struct literal shares utils.DefaultClient
+func (market *Market) httpClient() *utils.Client {
+	if market.client == nil {
+		return utils.DefaultClient
+	}
+	return market.client
+}
+
+// every Get*/…Response model embeds BaseResponse
+type apiResponse interface {
+	base() *BaseResponse
+}
+
+func (response *BaseResponse) base() *BaseResponse {
+	return response
+}
+
+func (market *Market) requestGet(ctx context.Context, class EndpointClass, uri string, result apiResponse) error {
+	return market.withRetry(ctx, func(attempt int) error {
+		if err := market.waitLimiter(ctx, class); err != nil {
+			return err
+		}
+		responseBytes, err := market.httpClient().Get(ctx, market.Host + uri)
+		return market.decodeResponse(uri, responseBytes, err, result)
+	})
+}
+
+func (market *Market) requestGetWithParams(ctx context.Context, class EndpointClass, uri string, params map[string]interface{}, result apiResponse) error {
+	return market.withRetry(ctx, func(attempt int) error {
+		if err := market.waitLimiter(ctx, class); err != nil {
+			return err
+		}
+		responseBytes, err := market.httpClient().GetJson(ctx, market.Host + uri, params)
+		return market.decodeResponse(uri, responseBytes, err, result)
+	})
+}
+
+// POST endpoints used here are queries or unsigned tx builds, both safe to repeat; broadcast has its own loop
+func (market *Market) requestPost(ctx context.Context, class EndpointClass, uri string, params map[string]interface{}, result apiResponse) error {
+	return market.withRetry(ctx, func(attempt int) error {
+		if err := market.waitLimiter(ctx, class); err != nil {
+			return err
+		}
+		responseBytes, err := market.httpClient().Post(ctx, market.Host + uri, params)
+		return market.decodeResponse(uri, responseBytes, err, result)
+	})
+}
+
+// Parsing the return value, failures are reported as *APIError 解析返回值
+func (market *Market) decodeResponse(uri string, responseBytes []byte, err error, result apiResponse) error {
+	if err != nil {
+		return wrapHttpError(uri, err)
+	}
+	err = json.Unmarshal(responseBytes, result)
+	if err != nil {
+		return err
+	}
+	if base := result.base(); !base.Success {
+		return newAPIError(uri, http.StatusOK, base, responseBytes)
+	}
+	if market.strictDecoding {
+		if report := checkStrict(responseBytes, result); report != nil {
+			report.Endpoint = uri
+			return report
+		}
+	}
+	return nil
 }
 
 /**
@@ -69,22 +217,21 @@ func (market *Market) Initialize() {
  * 获取服务器时间
  */
 func (market *Market) GetServeTime() (*time.Time, error) {
+	return market.GetServeTimeCtx(context.Background())
+}
+
+/**
+ * Get server time, the request is cancelled when ctx is done
+ * 获取服务器时间，ctx 结束时取消请求
+ */
+func (market *Market) GetServeTimeCtx(ctx context.Context) (*time.Time, error) {
 	uri := "/api/time"
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	// Parsing the return value 解析返回值
 	getTime := &GetTime{}
-	err = json.Unmarshal(responseBytes, getTime)
+	err := market.requestGet(ctx, ClassPublic, uri, getTime)
 	if err != nil {
 		return nil, err
 	}
-	if !getTime.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getTime.Code, getTime.Msg))
-	}
-	thisTime := time.Unix(getTime.Data / 1000, getTime.Data % 1000 * 1000)
+	thisTime := fromMillis(getTime.Data)
 	return &thisTime, nil
 }
 
@@ -93,22 +240,20 @@ func (market *Market) GetServeTime() (*time.Time, error) {
  * 获取交易市场的所有交易对信息
  */
 func (market *Market) GetSymbols() ([]*Symbol, error) {
+	return market.GetSymbolsCtx(context.Background())
+}
+
+/**
+ * Get information about all trading pairs in the trading market, the request is cancelled when ctx is done
+ * 获取交易市场的所有交易对信息，ctx 结束时取消请求
+ */
+func (market *Market) GetSymbolsCtx(ctx context.Context) ([]*Symbol, error) {
 	uri := "/api/tradings"
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println(string(responseBytes))
-	// Parsing the return value 解析返回值
 	getSymbols := &GetSymbols{}
-	err = json.Unmarshal(responseBytes, getSymbols)
+	err := market.requestGet(ctx, ClassPublic, uri, getSymbols)
 	if err != nil {
 		return nil, err
 	}
-	if !getSymbols.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getSymbols.Code, getSymbols.Msg))
-	}
 	return getSymbols.Data, nil
 }
 
@@ -117,55 +262,57 @@ func (market *Market) GetSymbols() ([]*Symbol, error) {
  * 获取交易对的ticker信息
  */
 func (market *Market) GetTicker(symbol string) (*Ticker, error) {
+	return market.GetTickerCtx(context.Background(), symbol)
+}
+
+/**
+ * Get ticker information of trading pairs, the request is cancelled when ctx is done
+ * 获取交易对的ticker信息，ctx 结束时取消请求
+ */
+func (market *Market) GetTickerCtx(ctx context.Context, symbol string) (*Ticker, error) {
 	if symbol == "" {
 		return nil, errors.New("symbol can not empty")
 	}
 	uri := fmt.Sprintf("/api/ticker/%s", symbol)
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println(string(responseBytes))
-	// Parsing the return value 解析返回值
 	getTicker := &GetTicker{}
-	err = json.Unmarshal(responseBytes, getTicker)
+	err := market.requestGet(ctx, ClassPublic, uri, getTicker)
 	if err != nil {
 		return nil, err
 	}
-	if !getTicker.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getTicker.Code, getTicker.Msg))
-	}
 	return getTicker.Data, nil
 }
 
 /**
- * Get information about all trading pairs in the trading market
- * 获取交易市场的所有交易对信息
+ * Get the kline of the trading pair
+ * 获取交易对的K线
+ */
+func (market *Market) Kline(symbol string, interval KlineInterval, size int) ([]*Kline, error) {
+	return market.KlineCtx(context.Background(), symbol, interval, size)
+}
+
+/**
+ * Get the kline of the trading pair, the request is cancelled when ctx is done
+ * 获取交易对的K线，ctx 结束时取消请求
  */
-func (market *Market) Kline(symbol string, inv, size int) ([]*Kline, error) {
+func (market *Market) KlineCtx(ctx context.Context, symbol string, interval KlineInterval, size int) ([]*Kline, error) {
+	if symbol == "" {
+		return nil, errors.New("symbol can not empty")
+	}
+	if !interval.Valid() {
+		return nil, fmt.Errorf("invalid kline interval %d", int(interval))
+	}
 	uri := "/api/kline"
-	url := market.Host + uri
 
 	params := map[string]interface{} {
 		"symbol":symbol,
-		"type":inv,
+		"type":interval,
 		"limit":size,
 	}
-	responseBytes, err := utils.RequestHttpGet(url, params)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println(string(responseBytes))
-	// Parsing the return value 解析返回值
 	getKline := &GetKline{}
-	err = json.Unmarshal(responseBytes, getKline)
+	err := market.requestGetWithParams(ctx, ClassPublic, uri, params, getKline)
 	if err != nil {
 		return nil, err
 	}
-	if !getKline.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getKline.Code, getKline.Msg))
-	}
 	return getKline.Data, nil
 }
 
@@ -174,10 +321,18 @@ func (market *Market) Kline(symbol string, inv, size int) ([]*Kline, error) {
  * 获取配置地址的资产余额
  */
 func (market *Market) GetBalance() ([]*Balance, error) {
+	return market.GetBalanceCtx(context.Background())
+}
+
+/**
+ * Get the asset balance of the configured address, the request is cancelled when ctx is done
+ * 获取配置地址的资产余额，ctx 结束时取消请求
+ */
+func (market *Market) GetBalanceCtx(ctx context.Context) ([]*Balance, error) {
 	if market.Address == "" {
 		return nil, errors.New("No address is configured")
 	}
-	return market.GetBalanceByAddress(market.Address)
+	return market.GetBalanceByAddressCtx(ctx, market.Address)
 }
 
 /**
@@ -185,24 +340,26 @@ func (market *Market) GetBalance() ([]*Balance, error) {
  * 获取指定地址的资产余额
  */
 func (market *Market) GetBalanceByAddress(address string) ([]*Balance, error) {
+	return market.GetBalanceByAddressCtx(context.Background(), address)
+}
+
+/**
+ * Get the asset balance of the specified address, the request is cancelled when ctx is done
+ * 获取指定地址的资产余额，ctx 结束时取消请求
+ */
+func (market *Market) GetBalanceByAddressCtx(ctx context.Context, address string) ([]*Balance, error) {
 	if address == "" {
 		return nil, errors.New("address can not empty")
 	}
-	uri := fmt.Sprintf("/api/ledger/%s", address)
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
+	if err := market.validateAddress(address); err != nil {
 		return nil, err
 	}
-	// Parsing the return value 解析返回值
+	uri := fmt.Sprintf("/api/ledger/%s", address)
 	getBalance := &GetBalance{}
-	err = json.Unmarshal(responseBytes, getBalance)
+	err := market.requestGet(ctx, ClassAccount, uri, getBalance)
 	if err != nil {
 		return nil, err
 	}
-	if !getBalance.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getBalance.Code, getBalance.Msg))
-	}
 	return getBalance.Data, nil
 }
 
@@ -211,24 +368,23 @@ func (market *Market) GetBalanceByAddress(address string) ([]*Balance, error) {
  * 获取指定交易对的盘口信息
  */
 func (market *Market) GetOrderBook(symbol string, size int) (*OrderBook, error) {
+	return market.GetOrderBookCtx(context.Background(), symbol, size)
+}
+
+/**
+ * Get the market information of the specified trading pair, the request is cancelled when ctx is done
+ * 获取指定交易对的盘口信息，ctx 结束时取消请求
+ */
+func (market *Market) GetOrderBookCtx(ctx context.Context, symbol string, size int) (*OrderBook, error) {
 	if symbol == "" {
 		return nil, errors.New("symbol can not empty")
 	}
 	uri := fmt.Sprintf("/api/orderBook/%s/%d", symbol, size)
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	// Parsing the return value 解析返回值
 	getOrderBook := &GetOrderBook{}
-	err = json.Unmarshal(responseBytes, getOrderBook)
+	err := market.requestGet(ctx, ClassPublic, uri, getOrderBook)
 	if err != nil {
 		return nil, err
 	}
-	if !getOrderBook.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getOrderBook.Code, getOrderBook.Msg))
-	}
 	return getOrderBook.Data, nil
 }
 
@@ -237,10 +393,18 @@ func (market *Market) GetOrderBook(symbol string, size int) (*OrderBook, error)
  * 获取配置地址对应交易对下的挂单
  */
 func (market *Market) GetOpenOrder(symbol string) ([]*Order, error) {
+	return market.GetOpenOrderCtx(context.Background(), symbol)
+}
+
+/**
+ * Obtain the pending order of the trading pair corresponding to the configured address, the request is cancelled when ctx is done
+ * 获取配置地址对应交易对下的挂单，ctx 结束时取消请求
+ */
+func (market *Market) GetOpenOrderCtx(ctx context.Context, symbol string) ([]*Order, error) {
 	if market.Address == "" {
 		return nil, errors.New("No address is configured")
 	}
-	return market.GetOpenOrderByAddress(market.Address, symbol)
+	return market.GetOpenOrderByAddressCtx(ctx, market.Address, symbol)
 }
 
 
@@ -249,28 +413,29 @@ func (market *Market) GetOpenOrder(symbol string) ([]*Order, error) {
  * 获取指定地址对应交易对下的挂单
  */
 func (market *Market) GetOpenOrderByAddress(address, symbol string) ([]*Order, error) {
+	return market.GetOpenOrderByAddressCtx(context.Background(), address, symbol)
+}
+
+/**
+ * Obtain the pending order of the corresponding transaction pair at the specified address, the request is cancelled when ctx is done
+ * 获取指定地址对应交易对下的挂单，ctx 结束时取消请求
+ */
+func (market *Market) GetOpenOrderByAddressCtx(ctx context.Context, address, symbol string) ([]*Order, error) {
 	if address == "" {
 		return nil, errors.New("address can not empty")
 	}
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
 	if symbol == "" {
 		return nil, errors.New("symbol can not empty")
 	}
 	uri := fmt.Sprintf("/api/openOrder/%s/%s", symbol, address)
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println(string(responseBytes))
-	// Parsing the return value 解析返回值
 	getOpenOrder := &GetOpenOrder{}
-	err = json.Unmarshal(responseBytes, getOpenOrder)
+	err := market.requestGet(ctx, ClassAccount, uri, getOpenOrder)
 	if err != nil {
 		return nil, err
 	}
-	if !getOpenOrder.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getOpenOrder.Code, getOpenOrder.Msg))
-	}
 	return getOpenOrder.Data, nil
 }
 
@@ -279,10 +444,18 @@ func (market *Market) GetOpenOrderByAddress(address, symbol string) ([]*Order, e
  * 获取配置地址对应交易对的订单列表（包括未成交的挂单）
  */
 func (market *Market) GetOrderList(symbol string, pageNumber, pageSize int) (*OrderList, error) {
+	return market.GetOrderListCtx(context.Background(), symbol, pageNumber, pageSize)
+}
+
+/**
+ * Get the list of orders corresponding to the trading address of the configured address, the request is cancelled when ctx is done
+ * 获取配置地址对应交易对的订单列表，ctx 结束时取消请求
+ */
+func (market *Market) GetOrderListCtx(ctx context.Context, symbol string, pageNumber, pageSize int) (*OrderList, error) {
 	if market.Address == "" {
 		return nil, errors.New("No address is configured")
 	}
-	return market.GetOrderListByAddress(market.Address, symbol, pageNumber, pageSize)
+	return market.GetOrderListByAddressCtx(ctx, market.Address, symbol, pageNumber, pageSize)
 }
 
 /**
@@ -290,34 +463,34 @@ func (market *Market) GetOrderList(symbol string, pageNumber, pageSize int) (*Or
  * 获取指定地址对应交易对的订单列表（包括未成交的挂单）
  */
 func (market *Market) GetOrderListByAddress(address, symbol string, pageNumber, pageSize int) (*OrderList, error) {
+	return market.GetOrderListByAddressCtx(context.Background(), address, symbol, pageNumber, pageSize)
+}
+
+/**
+ * Get a list of orders corresponding to the specified address, the request is cancelled when ctx is done
+ * 获取指定地址对应交易对的订单列表，ctx 结束时取消请求
+ */
+func (market *Market) GetOrderListByAddressCtx(ctx context.Context, address, symbol string, pageNumber, pageSize int) (*OrderList, error) {
 	if address == "" {
 		return nil, errors.New("address can not empty")
 	}
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
 	if symbol == "" {
 		return nil, errors.New("symbol can not empty")
 	}
-	url := market.Host + "/api/order/list"
 	params := map[string]interface{} {
 		"address":address,
 		"symbol":symbol,
 		"pageNumber":pageNumber,
 		"pageSize":pageSize,
 	}
-	responseBytes, err := utils.RequestPost(url, params)
-	if err != nil {
-		return nil, err
-	}
-	//fmt.Println(string(responseBytes))
-
-	// Parsing the return value 解析返回值
 	getOrderList := &GetOrderList{}
-	err = json.Unmarshal(responseBytes, getOrderList)
+	err := market.requestPost(ctx, ClassAccount, "/api/order/list", params, getOrderList)
 	if err != nil {
 		return nil, err
 	}
-	if !getOrderList.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getOrderList.Code, getOrderList.Msg))
-	}
 	//fmt.Println(getOrderList.Data)
 	return getOrderList.Data, nil
 }
@@ -327,25 +500,23 @@ func (market *Market) GetOrderListByAddress(address, symbol string, pageNumber,
  * 根据订单ID获取订单详情信息
  */
 func (market *Market) GetOrder(id string) (*Order, error) {
+	return market.GetOrderCtx(context.Background(), id)
+}
+
+/**
+ * Get order details based on order ID, the request is cancelled when ctx is done
+ * 根据订单ID获取订单详情信息，ctx 结束时取消请求
+ */
+func (market *Market) GetOrderCtx(ctx context.Context, id string) (*Order, error) {
 	if id == "" {
 		return nil, errors.New("order id can not empty")
 	}
 	uri := fmt.Sprintf("/api/order/%s", id)
-	url := market.Host + uri
-	responseBytes, err := utils.RequestGet(url)
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println(string(responseBytes))
-	// Parsing the return value 解析返回值
 	getOrder := &GetOrder{}
-	err = json.Unmarshal(responseBytes, getOrder)
+	err := market.requestGet(ctx, ClassAccount, uri, getOrder)
 	if err != nil {
 		return nil, err
 	}
-	if !getOrder.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", getOrder.Code, getOrder.Msg))
-	}
 	return getOrder.Data, nil
 }
 
@@ -353,88 +524,94 @@ func (market *Market) GetOrder(id string) (*Order, error) {
  * new order
  * 下单
  */
-func (market *Market) NewOrder(symbol string, slide int, price, quantity float64) (*Order, error) {
-	if market.Address == "" {
-		return nil, errors.New("No address is configured")
-	}
-	if market.PrivateKey == "" {
-		return nil, errors.New("No privateKey is configured")
+func (market *Market) NewOrder(symbol string, side Side, price, quantity Decimal) (*Order, error) {
+	return market.NewOrderCtx(context.Background(), symbol, side, price, quantity)
+}
+
+/**
+ * new order, ctx covers building, signing and broadcasting the transaction
+ * 下单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) NewOrderCtx(ctx context.Context, symbol string, side Side, price, quantity Decimal) (*Order, error) {
+	signer, release, err := market.orderSigner()
+	if err != nil {
+		return nil, err
 	}
-	return market.NewOrderByAddress(market.Address, market.PrivateKey, symbol, slide, price, quantity)
+	defer release()
+	return market.NewOrderWithSignerCtx(ctx, signer, symbol, side, price, quantity)
 }
 
 /**
  * new order
  * 下单
  */
-func (market *Market) NewOrderByAddress(address, privateKey, symbol string, slide int, price, quantity float64) (*Order, error) {
-	if symbol == "" {
-		return nil, errors.New("symbol can not empty")
-	}
+func (market *Market) NewOrderByAddress(address, privateKey, symbol string, side Side, price, quantity Decimal) (*Order, error) {
+	return market.NewOrderByAddressCtx(context.Background(), address, privateKey, symbol, side, price, quantity)
+}
+
+/**
+ * new order, ctx covers building, signing and broadcasting the transaction
+ * 下单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) NewOrderByAddressCtx(ctx context.Context, address, privateKey, symbol string, side Side, price, quantity Decimal) (*Order, error) {
 	if address == "" {
 		return nil, errors.New("address can not empty")
 	}
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
 	if privateKey == "" {
 		return nil, errors.New("privateKey can not empty")
 	}
-	url := market.Host + "/api/order"
-	params := map[string]interface{} {
-		"address":address,
-		"symbol":symbol,
-		"quantity":quantity,
-		"price":price,
-		"type":slide,
-	}
-	responseBytes, err := utils.RequestPost(url, params)
+	signer, err := NewKeySigner(address, privateKey)
 	if err != nil {
 		return nil, err
 	}
+	defer signer.Close()
+	return market.NewOrderWithSignerCtx(ctx, signer, symbol, side, price, quantity)
+}
 
-	newOrderResponse := &NewOrderResponse{}
-	err = json.Unmarshal(responseBytes, newOrderResponse)
-	if err != nil {
-		return nil, err
-	}
-	if !newOrderResponse.Success {
-		return nil, errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", newOrderResponse.Code, newOrderResponse.Msg))
+/**
+ * new order for the address of signer
+ * 使用 signer 对应的地址下单
+ */
+func (market *Market) NewOrderWithSigner(signer Signer, symbol string, side Side, price, quantity Decimal) (*Order, error) {
+	return market.NewOrderWithSignerCtx(context.Background(), signer, symbol, side, price, quantity)
+}
+
+/**
+ * new order for the address of signer, ctx covers building, signing and broadcasting the transaction
+ * 使用 signer 对应的地址下单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) NewOrderWithSignerCtx(ctx context.Context, signer Signer, symbol string, side Side, price, quantity Decimal) (*Order, error) {
+	if symbol == "" {
+		return nil, errors.New("symbol can not empty")
 	}
-	txBytes, err := hex.DecodeString(newOrderResponse.Data)
-	if err != nil {
-		return nil, err
+	if signer == nil {
+		return nil, errors.New("signer can not be nil")
 	}
-	tx := txprotocal.ParseTransactionByReader(seria.NewByteBufReader(txBytes, 0))
-	//sign
-	hash, err := tx.GetHash().Serialize()
-	if err != nil {
-		return nil, err
+	if !side.Valid() {
+		return nil, fmt.Errorf("invalid order side %d", int(side))
 	}
-	privateKeyBytes, err := hex.DecodeString(privateKey)
+	symbolInfo, err := market.Symbol(ctx, symbol)
 	if err != nil {
 		return nil, err
 	}
-	ecKey, err := eckey.FromPriKeyBytes(privateKeyBytes)
-	if err != nil {
-		log.Println("New Order ERROR : private key error, ", err)
+	if err := symbolInfo.ValidateOrder(price, quantity); err != nil {
 		return nil, err
 	}
-	signData, err := ecKey.Sign(hash)
-	if err != nil {
-		return nil, err
-	}
-	sign := txprotocal.P2PHKSignature{
-		SignValue: signData,
-		PublicKey: ecKey.GetPubKeyBytes(true),
-	}
-	writer := seria.NewByteBufWriter()
-	writer.WriteBytesWithLen(sign.PublicKey)
-	writer.WriteBytesWithLen(sign.SignValue)
-	tx.SignData = writer.Serialize()
-	// broadcast tx
-	txBytes, err = tx.Serialize()
-	if err != nil {
-		return nil, err
-	}
-	txHash, err := market.broadcast(hex.EncodeToString(txBytes))
+	address := signer.Address()
+	txHash, err := market.submitTx(ctx, signer, &TxIntent{
+		TxType: TxTypeTradingOrder,
+		Address: address,
+		PublicKey: signer.PublicKey(),
+		Symbol: symbolInfo,
+		Side: side,
+		Price: price,
+		Quantity: quantity,
+		FeeAddress: market.feeAddress,
+		FeeScale: market.feeScale,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -443,9 +620,9 @@ func (market *Market) NewOrderByAddress(address, privateKey, symbol string, slid
 		Address: address,
 		Symbol: symbol,
 		Price: price,
-		Type: slide,
+		Type: side,
 		BaseAmount: quantity,
-		Status: 1,
+		Status: OrderStatusOpen,
 	}
 	return order, nil
 }
@@ -455,13 +632,20 @@ func (market *Market) NewOrderByAddress(address, privateKey, symbol string, slid
  * 取消订单, 注意，配置的私钥必须和订单对应的地址匹配
  */
 func (market *Market) CancelOrder(orderId string) (string, error) {
-	if market.Address == "" {
-		return "", errors.New("No address is configured")
-	}
-	if market.PrivateKey == "" {
-		return "", errors.New("No privateKey is configured")
+	return market.CancelOrderCtx(context.Background(), orderId)
+}
+
+/**
+ * Cancel the order, ctx covers building, signing and broadcasting the transaction
+ * 取消订单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) CancelOrderCtx(ctx context.Context, orderId string) (string, error) {
+	signer, release, err := market.orderSigner()
+	if err != nil {
+		return "", err
 	}
-	return market.CancelOrderByAddress(orderId, market.PrivateKey)
+	defer release()
+	return market.CancelOrderWithSignerCtx(ctx, signer, orderId)
 }
 
 /**
@@ -469,110 +653,250 @@ func (market *Market) CancelOrder(orderId string) (string, error) {
  * 取消订单, 注意，传入的私钥必须和订单对应的地址匹配
  */
 func (market *Market) CancelOrderByAddress(orderId, privateKey string) (string, error) {
-	if orderId == "" {
-		return "", errors.New("orderId can not empty")
-	}
-	url := market.Host + "/api/cancelOrder"
-	params := map[string]interface{} {
-		"orderId":orderId,
-	}
-	responseBytes, err := utils.RequestPost(url, params)
-	if err != nil {
-		return "", err
-	}
-	newOrderResponse := &NewOrderResponse{}
-	err = json.Unmarshal(responseBytes, newOrderResponse)
-	if err != nil {
-		return "", err
-	}
-	if !newOrderResponse.Success {
-		return "", errors.New(fmt.Sprintf("the server return false, code=%d , msg=%s", newOrderResponse.Code, newOrderResponse.Msg))
+	return market.CancelOrderByAddressCtx(context.Background(), orderId, privateKey)
+}
+
+/**
+ * Cancel the order, ctx covers building, signing and broadcasting the transaction
+ * 取消订单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) CancelOrderByAddressCtx(ctx context.Context, orderId, privateKey string) (string, error) {
+	if privateKey == "" {
+		return "", errors.New("privateKey can not empty")
 	}
-	// sign tx
-	txBytes, err := hex.DecodeString(newOrderResponse.Data)
+	privateKeyBytes, err := hex.DecodeString(privateKey)
 	if err != nil {
 		return "", err
 	}
-	tx := txprotocal.ParseTransactionByReader(seria.NewByteBufReader(txBytes, 0))
-	hash, err := tx.GetHash().Serialize()
+	defer wipeBytes(privateKeyBytes)
+	// with a known network the owner of the order is checked against the address of the key
+	signerAddress, _ := market.addressOfKey(privateKey)
+	signer, err := newKeySigner(signerAddress, privateKeyBytes)
 	if err != nil {
 		return "", err
 	}
-	privateKeyBytes, err := hex.DecodeString(privateKey)
-	if err != nil {
-		return "", err
+	defer signer.Close()
+	return market.CancelOrderWithSignerCtx(ctx, signer, orderId)
+}
+
+/**
+ * Cancel the order, signer must belong to the address of the order
+ * 取消订单，signer 必须与订单对应的地址匹配
+ */
+func (market *Market) CancelOrderWithSigner(signer Signer, orderId string) (string, error) {
+	return market.CancelOrderWithSignerCtx(context.Background(), signer, orderId)
+}
+
+/**
+ * Cancel the order, ctx covers building, signing and broadcasting the transaction
+ * 取消订单，ctx 覆盖交易的组装、签名和广播
+ */
+func (market *Market) CancelOrderWithSignerCtx(ctx context.Context, signer Signer, orderId string) (string, error) {
+	if orderId == "" {
+		return "", errors.New("orderId can not empty")
 	}
-	ecKey, err := eckey.FromPriKeyBytes(privateKeyBytes)
-	if err != nil {
-		log.Println("New Order ERROR : private key error, ", err)
-		return "", err
+	if signer == nil {
+		return "", errors.New("signer can not be nil")
 	}
-	signData, err := ecKey.Sign(hash)
-	if err != nil {
-		return "", err
+	return market.submitTx(ctx, signer, &TxIntent{
+		TxType: TxTypeTradingOrderCancel,
+		Address: signer.Address(),
+		PublicKey: signer.PublicKey(),
+		OrderId: orderId,
+	})
+}
+
+// the configured signer, otherwise an in-memory signer for the configured address and private key;
+// release wipes the key of a signer created here and must be called once the signer is no longer used
+func (market *Market) orderSigner() (signer Signer, release func(), err error) {
+	if market.signer != nil {
+		return market.signer, func() {}, nil
 	}
-	sign := txprotocal.P2PHKSignature{
-		SignValue: signData,
-		PublicKey: ecKey.GetPubKeyBytes(true),
+	if market.Address == "" {
+		return nil, nil, errors.New("No address is configured")
 	}
-	writer := seria.NewByteBufWriter()
-	writer.WriteBytesWithLen(sign.PublicKey)
-	writer.WriteBytesWithLen(sign.SignValue)
-	tx.SignData = writer.Serialize()
-	// broadcast tx
-	txBytes, err = tx.Serialize()
-	if err != nil {
-		return "", err
+	if market.PrivateKey == "" {
+		return nil, nil, errors.New("No privateKey is configured")
 	}
-	txHash, err := market.broadcast(hex.EncodeToString(txBytes))
+	keySigner, err := NewKeySigner(market.Address, market.PrivateKey)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
-	return txHash, nil
+	return keySigner, func() { keySigner.Close() }, nil
 }
 
-func (market *Market) broadcast(txHex string) (string, error) {
-	url := market.Host + "/api/broadcast"
-	params := map[string]interface{} {
-		"txHex":txHex,
-	}
-	responseBytes, err := utils.RequestPost(url, params)
+/**
+ * Broadcast a signed transaction, retries re-send exactly the same tx hex. If an earlier attempt reached the
+ * node but its response was lost, the retry is rejected as a duplicate and the local tx hash is returned; an order
+ * whose retry is rejected for its nonce is looked up and counts as placed when the server knows it.
+ * 广播已签名的交易，重试时发送完全相同的交易。如果之前的请求已到达节点但响应丢失，重试会被当作重复交易拒绝，此时返回本地计算的交易hash；
+ * 重试因 nonce 被拒绝的订单会被查询，服务器存在该订单时视为已下单。
+ */
+func (market *Market) broadcast(ctx context.Context, tx *txprotocal.Transaction) (string, error) {
+	txBytes, err := tx.Serialize()
 	if err != nil {
 		return "", err
 	}
-	broadcastResponse := &BroadcastResponse{}
-	err = json.Unmarshal(responseBytes, broadcastResponse)
+	params := map[string]interface{} {
+		"txHex":hex.EncodeToString(txBytes),
+	}
+	uri := "/api/broadcast"
+	var txHash string
+	err = market.withRetry(ctx, func(attempt int) error {
+		if err := market.waitLimiter(ctx, ClassOrder); err != nil {
+			return err
+		}
+		broadcastResponse := &BroadcastResponse{}
+		responseBytes, err := market.httpClient().Post(ctx, market.Host + uri, params)
+		err = market.decodeResponse(uri, responseBytes, err, broadcastResponse)
+		if err != nil {
+			if attempt > 1 && errors.Is(err, ErrTxDuplicate) {
+				txHash = tx.GetHash().String()
+				return nil
+			}
+			// the earlier attempt may have spent the nonce of a resent order, the order itself tells
+			if attempt > 1 && errors.Is(err, ErrNonceConflict) && tx.TxType == TxTypeTradingOrder {
+				if order, lookupErr := market.GetOrderCtx(ctx, tx.GetHash().String()); lookupErr == nil && order != nil {
+					txHash = tx.GetHash().String()
+					return nil
+				}
+			}
+			return err
+		}
+		txHash = broadcastResponse.Data
+		return nil
+	})
 	if err != nil {
 		return "", err
 	}
-	if !broadcastResponse.Success {
-		return "", errors.New(fmt.Sprintf("[broadcast] the server return false, code=%d , msg=%s", broadcastResponse.Code, broadcastResponse.Msg))
-	}
-	return broadcastResponse.Data, nil
+	return txHash, nil
 }
 
-func (market *Market) getWebsocket() (*NdexWs, error) {
+func (market *Market) getWebsocket(ctx context.Context) (*NdexWs, error) {
+	market.wsMu.Lock()
+	defer market.wsMu.Unlock()
 	if market.ndexWs == nil {
 		market.ndexWs = &NdexWs{
 			Host: market.WsHost,
+			Dialer: market.wsDialer,
+			Header: market.wsHeader,
+			StrictDecoding: market.strictDecoding,
+			ReconnectBackoff: market.wsReconnectBackoff,
+			MaxReconnectAttempts: market.wsMaxReconnectAttempts,
+			PingInterval: market.wsPingInterval,
+			MaxMissedPongs: market.wsMaxMissedPongs,
 		}
-		err := market.ndexWs.Conn()
-		if err != nil {
+	}
+	// a websocket that gave up reconnecting is dialed again by the next call
+	if market.ndexWs.State() == ConnStateClosed {
+		if err := market.ndexWs.ConnCtx(ctx); err != nil {
 			return nil, err
 		}
 	}
 	return market.ndexWs, nil
 }
 
+/**
+ * Close the websocket, see NdexWs.Close, stop the clock syncs and order book watchers, drop idle rest connections and
+ * wipe the key unlocked by WithKeystore. The market can still be used afterwards, the websocket is dialed again by the
+ * next subscription, but a keystore market can no longer sign
+ * 关闭 websocket（参见 NdexWs.Close），停止时钟同步及盘口维护，断开空闲的 rest 连接并清除 WithKeystore 解锁的私钥。之后 Market
+ * 仍可使用，下一次订阅会重新连接 websocket，但使用 keystore 的 Market 无法再签名
+ */
+func (market *Market) Close(ctx context.Context) error {
+	market.stopBackground()
+	market.releaseSigner()
+	// a market built as a struct literal shares utils.DefaultClient, which is left alone
+	if market.client != nil && market.client.HttpClient != nil {
+		market.client.HttpClient.CloseIdleConnections()
+	}
+	market.wsMu.Lock()
+	ndexWs := market.ndexWs
+	market.wsMu.Unlock()
+	if ndexWs != nil {
+		if err := ndexWs.Close(ctx); err != nil {
+			return err
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		market.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run task until ctx is done or the market is closed, Close waits for it to return
+func (market *Market) goBackground(ctx context.Context, task func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	market.backgroundMu.Lock()
+	market.backgroundStops = append(market.backgroundStops, cancel)
+	market.background.Add(1)
+	market.backgroundMu.Unlock()
+	go func() {
+		defer market.background.Done()
+		defer cancel()
+		task(ctx)
+	}()
+}
+
+func (market *Market) stopBackground() {
+	market.backgroundMu.Lock()
+	defer market.backgroundMu.Unlock()
+	for _, stop := range market.backgroundStops {
+		stop()
+	}
+	market.backgroundStops = nil
+}
+
+/**
+ * Heartbeat and reconnect statistics of the websocket, the zero value with ConnStateClosed if it was never dialed
+ * websocket 的心跳及重连统计，从未连接时返回状态为 ConnStateClosed 的零值
+ */
+func (market *Market) WsStats() WsStats {
+	market.wsMu.Lock()
+	ndexWs := market.ndexWs
+	market.wsMu.Unlock()
+	if ndexWs == nil {
+		return WsStats{State: ConnStateClosed}
+	}
+	return ndexWs.Stats()
+}
+
+/**
+ * Connection state changes of the websocket, the websocket is dialed if needed
+ * websocket 连接状态的变化，必要时会先连接 websocket
+ */
+func (market *Market) WsStateChanges(ctx context.Context) (<-chan ConnStateChange, error) {
+	ndexWs, err := market.getWebsocket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ndexWs.StateChanges(), nil
+}
+
 /**
  * Pending orders and changes to the configuration address
  * 订阅配置地址的挂单及变化
  */
 func (market *Market) SubscribeOrderChange() (chan *WsOrderChange, error) {
+	return market.SubscribeOrderChangeCtx(context.Background())
+}
+
+/**
+ * Pending orders and changes to the configuration address, ctx bounds dialing and sending the subscription
+ * 订阅配置地址的挂单及变化，ctx 限制连接及发送订阅消息的时间
+ */
+func (market *Market) SubscribeOrderChangeCtx(ctx context.Context) (chan *WsOrderChange, error) {
 	if market.Address == "" {
 		return nil, errors.New("No address is configured")
 	}
-	return market.SubscribeOrderChangeByAddress(market.Address)
+	return market.SubscribeOrderChangeByAddressCtx(ctx, market.Address)
 }
 
 /**
@@ -580,11 +904,25 @@ func (market *Market) SubscribeOrderChange() (chan *WsOrderChange, error) {
  * 订阅指定地址的挂单及变化
  */
 func (market *Market) SubscribeOrderChangeByAddress(address string) (chan *WsOrderChange, error) {
-	ndexWs, err := market.getWebsocket()
+	return market.SubscribeOrderChangeByAddressCtx(context.Background(), address)
+}
+
+/**
+ * Subscribe to pending orders and changes at specified addresses, ctx bounds dialing and sending the subscription
+ * 订阅指定地址的挂单及变化，ctx 限制连接及发送订阅消息的时间
+ */
+func (market *Market) SubscribeOrderChangeByAddressCtx(ctx context.Context, address string) (chan *WsOrderChange, error) {
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
+	ndexWs, err := market.getWebsocket(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return ndexWs.SubscribeOrderChange(address)
+	if err := market.waitLimiter(ctx, ClassAccount); err != nil {
+		return nil, err
+	}
+	return ndexWs.SubscribeOrderChangeCtx(ctx, address)
 }
 
 /**
@@ -592,11 +930,22 @@ func (market *Market) SubscribeOrderChangeByAddress(address string) (chan *WsOrd
  * 订阅交易对盘口及变化
  */
 func (market *Market) SubscribeOrderBook(symbol string, top int) (chan *OrderBook, error) {
-	ndexWs, err := market.getWebsocket()
+	return market.SubscribeOrderBookCtx(context.Background(), symbol, top)
+}
+
+/**
+ * Subscription transaction changes to order book, ctx bounds dialing and sending the subscription
+ * 订阅交易对盘口及变化，ctx 限制连接及发送订阅消息的时间
+ */
+func (market *Market) SubscribeOrderBookCtx(ctx context.Context, symbol string, top int) (chan *OrderBook, error) {
+	ndexWs, err := market.getWebsocket(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return ndexWs.SubscribeOrderBook(symbol, top)
+	if err := market.waitLimiter(ctx, ClassPublic); err != nil {
+		return nil, err
+	}
+	return ndexWs.SubscribeOrderBookCtx(ctx, symbol, top)
 }
 
 /**
@@ -604,11 +953,22 @@ func (market *Market) SubscribeOrderBook(symbol string, top int) (chan *OrderBoo
  * 取消订阅交易对盘口及变化
  */
 func (market *Market) UnSubscribeOrderBook(symbol string) (error) {
-	ndexWs, err := market.getWebsocket()
+	return market.UnSubscribeOrderBookCtx(context.Background(), symbol)
+}
+
+/**
+ * UnSubscription transaction changes to order book, ctx bounds sending the message
+ * 取消订阅交易对盘口及变化，ctx 限制发送消息的时间
+ */
+func (market *Market) UnSubscribeOrderBookCtx(ctx context.Context, symbol string) (error) {
+	ndexWs, err := market.getWebsocket(ctx)
 	if err != nil {
 		return err
 	}
-	return ndexWs.UnSubscribeOrderBook(symbol)
+	if err := market.waitLimiter(ctx, ClassPublic); err != nil {
+		return err
+	}
+	return ndexWs.UnSubscribeOrderBookCtx(ctx, symbol)
 }
 
 /**
@@ -616,10 +976,18 @@ func (market *Market) UnSubscribeOrderBook(symbol string) (error) {
  * 取消订阅配置地址的挂单及变化
  */
 func (market *Market) UnSubscribeOrderChange() (error) {
+	return market.UnSubscribeOrderChangeCtx(context.Background())
+}
+
+/**
+ * UnSubscription Pending orders and changes to the configuration address, ctx bounds sending the message
+ * 取消订阅配置地址的挂单及变化，ctx 限制发送消息的时间
+ */
+func (market *Market) UnSubscribeOrderChangeCtx(ctx context.Context) (error) {
 	if market.Address == "" {
 		return errors.New("No address is configured")
 	}
-	return market.UnSubscribeOrderChangeByAddress(market.Address)
+	return market.UnSubscribeOrderChangeByAddressCtx(ctx, market.Address)
 }
 
 /**
@@ -627,11 +995,25 @@ func (market *Market) UnSubscribeOrderChange() (error) {
  * 取消订阅指定地址的挂单及变化
  */
 func (market *Market) UnSubscribeOrderChangeByAddress(address string) (error) {
-	ndexWs, err := market.getWebsocket()
+	return market.UnSubscribeOrderChangeByAddressCtx(context.Background(), address)
+}
+
+/**
+ * UnSubscription to pending orders and changes at specified addresses, ctx bounds sending the message
+ * 取消订阅指定地址的挂单及变化，ctx 限制发送消息的时间
+ */
+func (market *Market) UnSubscribeOrderChangeByAddressCtx(ctx context.Context, address string) (error) {
+	if err := market.validateAddress(address); err != nil {
+		return err
+	}
+	ndexWs, err := market.getWebsocket(ctx)
 	if err != nil {
 		return err
 	}
-	return ndexWs.UnSubscribeOrderChange(address)
+	if err := market.waitLimiter(ctx, ClassAccount); err != nil {
+		return err
+	}
+	return ndexWs.UnSubscribeOrderChangeCtx(ctx, address)
 }
 
 
@@ -640,10 +1022,18 @@ func (market *Market) UnSubscribeOrderChangeByAddress(address string) (error) {
  * 订阅配置地址的余额变化
  */
 func (market *Market) SubscribeBalanceChange() (chan *WsBalanceChange, error) {
+	return market.SubscribeBalanceChangeCtx(context.Background())
+}
+
+/**
+ * Subscription configuration address balance changes, ctx bounds dialing and sending the subscription
+ * 订阅配置地址的余额变化，ctx 限制连接及发送订阅消息的时间
+ */
+func (market *Market) SubscribeBalanceChangeCtx(ctx context.Context) (chan *WsBalanceChange, error) {
 	if market.Address == "" {
 		return nil, errors.New("No address is configured")
 	}
-	return market.SubscribeBalanceChangeByAddress(market.Address)
+	return market.SubscribeBalanceChangeByAddressCtx(ctx, market.Address)
 }
 
 /**
@@ -651,9 +1041,23 @@ func (market *Market) SubscribeBalanceChange() (chan *WsBalanceChange, error) {
  * 订阅指定地址的余额变化
  */
 func (market *Market) SubscribeBalanceChangeByAddress(address string) (chan *WsBalanceChange, error) {
-	ndexWs, err := market.getWebsocket()
+	return market.SubscribeBalanceChangeByAddressCtx(context.Background(), address)
+}
+
+/**
+ * Subscribe to the balance change of the specified address, ctx bounds dialing and sending the subscription
+ * 订阅指定地址的余额变化，ctx 限制连接及发送订阅消息的时间
+ */
+func (market *Market) SubscribeBalanceChangeByAddressCtx(ctx context.Context, address string) (chan *WsBalanceChange, error) {
+	if err := market.validateAddress(address); err != nil {
+		return nil, err
+	}
+	ndexWs, err := market.getWebsocket(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return ndexWs.SubscribeBalanceChange(address)
-}
\ No newline at end of file
+	if err := market.waitLimiter(ctx, ClassAccount); err != nil {
+		return nil, err
+	}
+	return ndexWs.SubscribeBalanceChangeCtx(ctx, address)
+}
@@ -29,9 +29,13 @@ Copyright (c) 2019-2020 nerve.network
 package ndex
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 var (
@@ -39,8 +43,8 @@ var (
 )
 
 func init() {
-	host := "http://beta.nervedex.com"
-	wsHost := "ws://beta.nervedex.com"
+	host := Beta().Host
+	wsHost := Beta().WsHost
 	market = &Market{
 		Host: host,
 		WsHost: wsHost,
@@ -63,6 +67,30 @@ func TestMarket_GetServeTime(t *testing.T) {
 	fmt.Println(tm)
 }
 
+func TestMarket_GetServeTimeCtx(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <- release:
+		case <- r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	stalled := &Market{Host: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := stalled.GetServeTimeCtx(ctx)
+	if err == nil {
+		t.Fatal("expected the stalled request to fail")
+	}
+	if time.Since(start) > 5 * time.Second {
+		t.Fatalf("request was not cancelled by the context, took %s", time.Since(start))
+	}
+}
+
 func TestMarket_GetSymbols(t *testing.T) {
 	symbols, err := market.GetSymbols()
 	if err != nil {
@@ -95,7 +123,7 @@ func TestMarket_GetTicker(t *testing.T) {
 
 func TestMarket_Kline(t *testing.T) {
 	symbol := "NVTNULS"
-	klines, err := market.Kline(symbol, 1, 10)
+	klines, err := market.Kline(symbol, KlineType1, 10)
 	if err != nil {
 		t.Error(err)
 		return
@@ -194,7 +222,7 @@ func TestMarket_GetOrder(t *testing.T) {
 }
 
 func TestMarket_NewOrder(t *testing.T) {
-	order, err := market.NewOrderByAddress("TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD", "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df", "NVTNULS", 1, 8000, 1)
+	order, err := market.NewOrderByAddress("TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD", "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df", "NVTNULS", SideBuy, NewDecimalFromInt(8000), NewDecimalFromInt(1))
 	if err != nil {
 		t.Error(err)
 		return
@@ -29,147 +29,154 @@ Copyright (c) 2019-2020 nerve.network
 package ndex
 
 type BaseResponse struct {
-	Code	int		`"json:code"`
-	Success bool	`"json:success"`
-	Msg		string	`"json:msg"`
+	Code	int		`json:"code"`
+	Success bool	`json:"success"`
+	Msg		string	`json:"msg"`
 }
 
 type GetTime struct {
 	BaseResponse
-	Data	int64	`"json:data"`
+	Data	int64	`json:"data"`
 }
 
 type GetSymbols struct {
 	BaseResponse
-	Data	[]*Symbol	`"json:data"`
+	Data	[]*Symbol	`json:"data"`
 }
 
 type Symbol struct {
-	Symbol 				string		`"json:symbol"`					//交易对名称
-	BaseAssetName 		string		`"json:baseAssetName"`			//交易资产名称
-	BaseDecimal			int			`"json:baseDecimal"`			//交易资产小数位数
-	QuoteAssetName 		string		`"json:quoteAssetName"`			//货币资产名称
-	QuoteDecimal		int			`"json:quoteDecimal"`			//货币资产小数位数
-	BaseMinTradingAmount	float64	`"json:baseMinTradingAmount"`	//最小委托的数量（交易资产）
+	Symbol 				string		`json:"symbol"`					//交易对名称
+	BaseAssetName 		string		`json:"baseAssetName"`			//交易资产名称
+	BaseDecimal			int			`json:"baseDecimal"`			//交易资产小数位数
+	QuoteAssetName 		string		`json:"quoteAssetName"`			//货币资产名称
+	QuoteDecimal		int			`json:"quoteDecimal"`			//货币资产小数位数
+	BaseMinTradingAmount	Decimal	`json:"baseMinTradingAmount"`	//最小委托的数量（交易资产）
+	Hash				string		`json:"hash,omitempty"`				//交易对hash，本地组装交易时需要
+	BaseAssetChainId	int			`json:"baseAssetChainId,omitempty"`	//交易资产的链ID
+	BaseAssetId			int			`json:"baseAssetId,omitempty"`		//交易资产的资产ID
+	QuoteAssetChainId	int			`json:"quoteAssetChainId,omitempty"`	//货币资产的链ID
+	QuoteAssetId		int			`json:"quoteAssetId,omitempty"`		//货币资产的资产ID
 }
 
 type GetTicker struct {
 	BaseResponse
-	Data	*Ticker	`"json:data"`
+	Data	*Ticker	`json:"data"`
 }
 
 type Ticker struct {
-	Symbol 		string		`"json:symbol"`		//交易对名称
-	Volume		float64		`"json:volume"`		//24小时成交量
-	Open		float64		`"json:open"`		//24小时开盘价
-	High		float64		`"json:high"`		//24小时最高价格
-	Last		float64		`"json:last"`		//最新成交价
-	Low			float64		`"json:low"`		//24小时最低价格
-	Ask			float64		`"json:ask"`		//盘口最高卖单价
-	Bid			float64		`"json:bid"`		//盘口最高买单价
-	Time		int64		`"json:time"`		//最新成交时间
+	Symbol 		string		`json:"symbol"`		//交易对名称
+	Volume		Decimal		`json:"volume"`		//24小时成交量
+	Open		Decimal		`json:"open"`		//24小时开盘价
+	High		Decimal		`json:"high"`		//24小时最高价格
+	Last		Decimal		`json:"last"`		//最新成交价
+	Low			Decimal		`json:"low"`		//24小时最低价格
+	Ask			Decimal		`json:"ask"`		//盘口最高卖单价
+	Bid			Decimal		`json:"bid"`		//盘口最高买单价
+	Time		int64		`json:"time"`		//最新成交时间
 }
 
 type GetKline struct {
 	BaseResponse
-	Data	[]*Kline	`"json:data"`
+	Data	[]*Kline	`json:"data"`
 }
 
 type Kline struct {
-	Time		int64		`"json:time"`		//时间
-	Volume		float64		`"json:volume"`		//成交量
-	Open		float64		`"json:open"`		//开盘价
-	Close		float64		`"json:close"`		//收盘价
-	High		float64		`"json:high"`		//最高价
-	Low			float64		`"json:low"`		//最低价
+	Time		int64		`json:"time"`		//时间
+	Volume		Decimal		`json:"volume"`		//成交量
+	Open		Decimal		`json:"open"`		//开盘价
+	Close		Decimal		`json:"close"`		//收盘价
+	High		Decimal		`json:"high"`		//最高价
+	Low			Decimal		`json:"low"`		//最低价
 }
 
 type GetBalance struct {
 	BaseResponse
-	Data	[]*Balance	`"json:data"`
+	Data	[]*Balance	`json:"data"`
 }
 
 type Balance struct {
-	Available		float64		`"json:available"`	//可用金额
-	Freeze			float64		`"json:freeze"`		//冻结金额
-	AssetName		string		`"json:assetName"`	//资产名称
-	Nonce			string 		`"json:nonce"`		//地址的Nonce值
+	Available		Decimal		`json:"available"`	//可用金额
+	Freeze			Decimal		`json:"freeze"`		//冻结金额
+	AssetName		string		`json:"assetName"`	//资产名称
+	Nonce			string 		`json:"nonce"`		//地址的Nonce值
 }
 
 type GetOrderBook struct {
 	BaseResponse
-	Data	*OrderBook	`"json:data"`
+	Data	*OrderBook	`json:"data"`
 }
 
 type OrderBook struct {
-	Symbol 			string		`"json:symbol"`
-	UpdateTime		int64		`"json:updateTime"`
-	SellList		[][]float64	`"json:sellList"`
-	BuyList			[][]float64	`"json:buyList"`
+	Symbol 			string		`json:"symbol"`
+	UpdateTime		int64		`json:"updateTime"`
+	SellList		[][]Decimal	`json:"sellList"`
+	BuyList			[][]Decimal	`json:"buyList"`
+	Resync			bool		`json:"-"`	// set on the marker sent after a websocket reconnect, updates may have been missed
 }
 
 type GetOpenOrder struct {
 	BaseResponse
-	Data	[]*Order	`"json:data"`
+	Data	[]*Order	`json:"data"`
 }
 
 type Order struct {
-	Id 				string		`"json:id"`					//订单ID
-	Symbol 			string		`"json:symbol"`				//交易对名称
-	Address 		string		`"json:address"`			//订单对应的地址
-	Type 			int			`"json:type"`				//订单类型，1买，2卖
-	BaseAmount		float64		`"json:baseAmount"`			//委托数量
-	BaseDealAmount	float64		`"json:baseDealAmount"`		//已成交数量
-	Price			float64		`"json:price"`				//委托价格
-	AvgPrice		float64		`"json:avgPrice"`			//平均成交价格
-	QuoteDealAmount	float64		`"json:quoteDealAmount"`	//已成交金额
-	LeftAmount		float64		`"json:leftAmount"`			//未成交数量
-	Status			int			`"json:status"`				//委托单状态 1：挂单中，2:部分成交、3:已成交 、4已撤销、5，部分成交已撤单。
-	CreateTime		int64		`"json:createTime"`			//创建时间
+	Id 				string		`json:"id"`					//订单ID
+	Symbol 			string		`json:"symbol"`				//交易对名称
+	Address 		string		`json:"address"`			//订单对应的地址
+	Type 			Side		`json:"type"`				//订单类型，1买，2卖
+	BaseAmount		Decimal		`json:"baseAmount"`			//委托数量
+	BaseDealAmount	Decimal		`json:"baseDealAmount"`		//已成交数量
+	Price			Decimal		`json:"price"`				//委托价格
+	AvgPrice		Decimal		`json:"avgPrice"`			//平均成交价格
+	QuoteDealAmount	Decimal		`json:"quoteDealAmount"`	//已成交金额
+	LeftAmount		Decimal		`json:"leftAmount"`			//未成交数量
+	Status			OrderStatus	`json:"status"`				//委托单状态 1：挂单中，2:部分成交、3:已成交 、4已撤销、5，部分成交已撤单。
+	CreateTime		int64		`json:"createTime"`			//创建时间
 }
 
 type GetOrderList struct {
 	BaseResponse
-	Data	*OrderList	`"json:data"`
+	Data	*OrderList	`json:"data"`
 }
 
 type OrderList struct {
-	Data	[]*Order	`"json:data"`
-	Total	int			`"json:total"`
+	Data	[]*Order	`json:"data"`
+	Total	int			`json:"total"`
 }
 
 type GetOrder struct {
 	BaseResponse
-	Data	*Order	`"json:data"`
+	Data	*Order	`json:"data"`
 }
 
 type WsResponse struct {
-	Channel 				string		`"json:channel"`
-	Action 					string		`"json:action"`
-	Status					int			`"json:status"`
+	Channel 				string		`json:"channel"`
+	Action 					string		`json:"action"`
+	Status					int			`json:"status"`
 }
 
 type WsPong struct {
-	Pong		int64		`"json:pong"`
+	Pong		int64		`json:"pong"`
 }
 
 type WsOrderBookResponse struct {
-	Channel 				string		`"json:channel"`
-	Action 					string		`"json:action"`
-	Status					int			`"json:status"`
-	Data 					*OrderBook	`"json:data"`
+	Channel 				string		`json:"channel"`
+	Action 					string		`json:"action"`
+	Status					int			`json:"status"`
+	Data 					*OrderBook	`json:"data"`
 }
 
 type WsOrderChangeResponse struct {
-	Channel 				string		`"json:channel"`
-	Action 					string		`"json:action"`
-	Status					int			`"json:status"`
-	Data 					*WsOrderChange	`"json:data"`
+	Channel 				string		`json:"channel"`
+	Action 					string		`json:"action"`
+	Status					int			`json:"status"`
+	Data 					*WsOrderChange	`json:"data"`
 }
 
 type WsOrderChange struct {
-	T			string		`"json:t"`
-	D			[]*Order	`"json:d"`
+	T			string		`json:"t"`
+	D			[]*Order	`json:"d"`
+	Resync		bool		`json:"-"`	// set on the marker sent after a websocket reconnect, updates may have been missed
 }
 
 type WsSubInfo struct {
@@ -180,23 +187,24 @@ type WsSubInfo struct {
 
 type NewOrderResponse struct {
 	BaseResponse
-	Data	string	`"json:data"`
+	Data	string	`json:"data"`
 }
 
 type BroadcastResponse struct {
 	BaseResponse
-	Data	string	`"json:data"`
+	Data	string	`json:"data"`
 }
 
 type WsBalanceChangeResponse struct {
-	Channel 				string		`"json:channel"`
-	Action 					string		`"json:action"`
-	Status					int			`"json:status"`
-	Data 					*WsBalanceChange	`"json:data"`
+	Channel 				string		`json:"channel"`
+	Action 					string		`json:"action"`
+	Status					int			`json:"status"`
+	Data 					*WsBalanceChange	`json:"data"`
 }
 
 type WsBalanceChange struct {
-	T			string		`"json:t"`
-	A			string		`"json:a"`
-	D			[]*Balance	`"json:d"`
+	T			string		`json:"t"`
+	A			string		`json:"a"`
+	D			[]*Balance	`json:"d"`
+	Resync		bool		`json:"-"`	// set on the marker sent after a websocket reconnect, updates may have been missed
 }
\ No newline at end of file
@@ -0,0 +1,126 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/8 下午5:00
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// recorded api payloads in testdata, every response model must decode them strictly and encode them back unchanged
+var goldenPayloads = []struct {
+	file	string
+	model	func() interface{}
+}{
+	{"time.json", func() interface{} { return &GetTime{} }},
+	{"tradings.json", func() interface{} { return &GetSymbols{} }},
+	{"ticker.json", func() interface{} { return &GetTicker{} }},
+	{"kline.json", func() interface{} { return &GetKline{} }},
+	{"ledger.json", func() interface{} { return &GetBalance{} }},
+	{"order_book.json", func() interface{} { return &GetOrderBook{} }},
+	{"open_order.json", func() interface{} { return &GetOpenOrder{} }},
+	{"order_list.json", func() interface{} { return &GetOrderList{} }},
+	{"order.json", func() interface{} { return &GetOrder{} }},
+	{"order_build.json", func() interface{} { return &NewOrderResponse{} }},
+	{"broadcast.json", func() interface{} { return &BroadcastResponse{} }},
+	{"ws_order_book.json", func() interface{} { return &WsOrderBookResponse{} }},
+	{"ws_order_change.json", func() interface{} { return &WsOrderChangeResponse{} }},
+	{"ws_balance_change.json", func() interface{} { return &WsBalanceChangeResponse{} }},
+	{"ws_pong.json", func() interface{} { return &WsPong{} }},
+}
+
+func TestModel_GoldenRoundTrip(t *testing.T) {
+	for _, golden := range goldenPayloads {
+		t.Run(golden.file, func(t *testing.T) {
+			payload, err := ioutil.ReadFile(filepath.Join("testdata", golden.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			model := golden.model()
+			if err := DecodeStrict(payload, model); err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.Marshal(model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want, got interface{}
+			if err := json.Unmarshal(payload, &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("round trip changed the payload\nwant %s\ngot  %s", payload, encoded)
+			}
+		})
+	}
+}
+
+func TestDecodeStrict_ReportsDrift(t *testing.T) {
+	payload := []byte(`{"code":0,"success":true,"msg":"","data":{"symbol":"NVTNULS","volume":1,"open":1,"high":1,"low":1,"ask":1,"bid":1,"time":1,"feeRate":0.001}}`)
+	ticker := &GetTicker{}
+	err := DecodeStrict(payload, ticker)
+	var report *DecodeError
+	if !errors.As(err, &report) {
+		t.Fatalf("err = %v", err)
+	}
+	if !reflect.DeepEqual(report.Unknown, []string{"data.feeRate"}) || !reflect.DeepEqual(report.Missing, []string{"data.last"}) {
+		t.Errorf("unknown %v, missing %v", report.Unknown, report.Missing)
+	}
+	if ticker.Data == nil || ticker.Data.Symbol != "NVTNULS" {
+		t.Error("payload was not decoded")
+	}
+}
+
+func TestMarket_StrictDecoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"success":true,"msg":"","data":1589271332077,"serverId":3}`))
+	}))
+	defer server.Close()
+
+	lenient, _ := NewMarket(WithHost(server.URL))
+	if _, err := lenient.GetServeTimeCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	strict, _ := NewMarket(WithHost(server.URL), WithStrictDecoding())
+	_, err := strict.GetServeTimeCtx(context.Background())
+	var report *DecodeError
+	if !errors.As(err, &report) || report.Endpoint != "/api/time" || len(report.Unknown) != 1 {
+		t.Fatalf("err = %v", err)
+	}
+}
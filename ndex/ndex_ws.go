@@ -29,176 +29,250 @@ Copyright (c) 2019-2020 nerve.network
 package ndex
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
 	"github.com/gorilla/websocket"
 )
 
 type NdexWs struct {
 	Host 				string
+	Dialer				*websocket.Dialer	// nil uses websocket.DefaultDialer
+	Header				http.Header			// extra handshake headers
+	StrictDecoding		bool				// log a warning when a message does not match its model
+	ReconnectBackoff	*utils.Backoff		// nil uses DefaultReconnectBackoff
+	MaxReconnectAttempts	int				// give up and close after this many failed attempts in a row, 0 retries forever
+	PingInterval		time.Duration		// 0 uses DefaultPingInterval
+	MaxMissedPongs		int					// reconnect after this many unanswered pings, 0 uses DefaultMaxMissedPongs
+
+	// readChannel and writeChannel outlive connections, the handlers of a connection stop when its connDone is closed
 	readChannel 		chan string
 	writeChannel 		chan string
-	done 				chan struct{}
+
+	mu					sync.Mutex
+	state				ConnState
 	conn 				*websocket.Conn
+	connDone			chan struct{}
+	readDone			chan struct{}		// closed when the reader of conn returns
+	stopped				chan struct{}		// closed when the state becomes ConnStateClosed
+	closing				bool				// set by Close, lost connections are not re-established
+	stateChanges		chan ConnStateChange
+	handlers			sync.WaitGroup		// every goroutine started for the websocket, waited for by Close
+	heartbeat			heartbeat
 
-	subscribeMap 		map[string]*WsSubInfo
+	subscriptions		subscriptionRegistry
 }
 
 func (ws *NdexWs) Ping() {
 	msg := fmt.Sprintf("{\"ping\":%d}", time.Now().UnixNano() / 1e6)
-	ws.writeChannel <- msg
+	ws.send(context.Background(), msg)
+}
+
+// queue msg for the writer of the current connection, while reconnecting it waits for the next one
+func (ws *NdexWs) send(ctx context.Context, msg string) error {
+	ws.mu.Lock()
+	writeChannel, stopped := ws.writeChannel, ws.stopped
+	ws.mu.Unlock()
+	if writeChannel == nil {
+		return errors.New("ndex websocket is not connected")
+	}
+	select {
+	case <- stopped:
+		return ErrWsClosed
+	default:
+	}
+	select {
+	case writeChannel <- msg:
+		return nil
+	case <- stopped:
+		return ErrWsClosed
+	case <- ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (ws *NdexWs) SubscribeOrderBook(symbol string, top int) (chan *OrderBook, error) {
-	msg := fmt.Sprintf("{\"action\":\"Subscribe\",\"channel\":\"apiOrderBook:{\\\"symbol\\\":\\\"%s\\\",\\\"top\\\":%d}\"}", symbol, top)
-	ws.writeChannel <- msg
+	return ws.SubscribeOrderBookCtx(context.Background(), symbol, top)
+}
 
+func (ws *NdexWs) SubscribeOrderBookCtx(ctx context.Context, symbol string, top int) (chan *OrderBook, error) {
+	msg := fmt.Sprintf("{\"action\":\"Subscribe\",\"channel\":\"apiOrderBook:{\\\"symbol\\\":\\\"%s\\\",\\\"top\\\":%d}\"}", symbol, top)
 	channel := fmt.Sprintf("apiOrderBook:%s", symbol)
-	subInfo := ws.subscribeMap[channel]
-	if subInfo == nil {
-		orderBookEvent := make(chan *OrderBook, 30)
-		subInfo = &WsSubInfo{
-			Channel: 	channel,
-			SubMessage: msg,
-			Event: 		orderBookEvent,
-		}
-		ws.subscribeMap[channel] = subInfo
+	event, err := ws.subscribe(ctx, channel, msg, orderBookUnsubMessage(symbol), func() interface{} {
+		return make(chan *OrderBook, 30)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return subInfo.Event.(chan *OrderBook), nil
+	return event.(chan *OrderBook), nil
 }
 
 func (ws *NdexWs) SubscribeOrderChange(address string) (chan *WsOrderChange, error) {
+	return ws.SubscribeOrderChangeCtx(context.Background(), address)
+}
+
+func (ws *NdexWs) SubscribeOrderChangeCtx(ctx context.Context, address string) (chan *WsOrderChange, error) {
 	channel := fmt.Sprintf("order:%s", address)
 	msg := fmt.Sprintf("{\"action\":\"Subscribe\",\"channel\":\"%s\"}", channel)
-	ws.writeChannel <- msg
-
-	subInfo := ws.subscribeMap[channel]
-	if subInfo == nil {
-		orderChangeEvent := make(chan *WsOrderChange, 10)
-		subInfo = &WsSubInfo{
-			Channel: 	channel,
-			SubMessage: msg,
-			Event: 		orderChangeEvent,
-		}
-		ws.subscribeMap[channel] = subInfo
+	event, err := ws.subscribe(ctx, channel, msg, unsubMessage(channel), func() interface{} {
+		return make(chan *WsOrderChange, 10)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return subInfo.Event.(chan *WsOrderChange), nil
+	return event.(chan *WsOrderChange), nil
 }
 
 func (ws *NdexWs) SubscribeBalanceChange(address string) (chan *WsBalanceChange, error) {
+	return ws.SubscribeBalanceChangeCtx(context.Background(), address)
+}
+
+func (ws *NdexWs) SubscribeBalanceChangeCtx(ctx context.Context, address string) (chan *WsBalanceChange, error) {
 	channel := fmt.Sprintf("account:%s", address)
 	msg := fmt.Sprintf("{\"action\":\"Subscribe\",\"channel\":\"%s\"}", channel)
-	ws.writeChannel <- msg
-
-	subInfo := ws.subscribeMap[channel]
-	if subInfo == nil {
-		balanceChangeEvent := make(chan *WsBalanceChange, 10)
-		subInfo = &WsSubInfo{
-			Channel: 	channel,
-			SubMessage: msg,
-			Event: 		balanceChangeEvent,
-		}
-		ws.subscribeMap[channel] = subInfo
+	event, err := ws.subscribe(ctx, channel, msg, unsubMessage(channel), func() interface{} {
+		return make(chan *WsBalanceChange, 10)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return subInfo.Event.(chan *WsBalanceChange), nil
+	return event.(chan *WsBalanceChange), nil
 }
 
 func (ws *NdexWs) UnSubscribeOrderBook(symbol string) error {
-	msg := fmt.Sprintf("{\"action\":\"Unsubscribe\",\"channel\":\"apiOrderBook:{\\\"symbol\\\":\\\"%s\\\"}\"}", symbol)
-	ws.writeChannel <- msg
-	channel := fmt.Sprintf("apiOrderBook:%s", symbol)
-	wsSubInfo := ws.subscribeMap[channel]
-	close(wsSubInfo.Event.(chan *OrderBook))
-	delete(ws.subscribeMap, channel)
-	return nil
+	return ws.UnSubscribeOrderBookCtx(context.Background(), symbol)
+}
+
+func (ws *NdexWs) UnSubscribeOrderBookCtx(ctx context.Context, symbol string) error {
+	return ws.unsubscribe(ctx, fmt.Sprintf("apiOrderBook:%s", symbol), orderBookUnsubMessage(symbol))
 }
 
 func (ws *NdexWs) UnSubscribeOrderChange(address string) error {
-	msg := fmt.Sprintf("{\"action\":\"Unsubscribe\",\"channel\":\"order:%s\"}", address)
-	ws.writeChannel <- msg
+	return ws.UnSubscribeOrderChangeCtx(context.Background(), address)
+}
+
+func (ws *NdexWs) UnSubscribeOrderChangeCtx(ctx context.Context, address string) error {
 	channel := fmt.Sprintf("order:%s", address)
-	wsSubInfo := ws.subscribeMap[channel]
-	close(wsSubInfo.Event.(chan *WsOrderChange))
-	delete(ws.subscribeMap, channel)
-	return nil
+	return ws.unsubscribe(ctx, channel, unsubMessage(channel))
 }
 
 func (ws *NdexWs) UnSubscribeBalanceChange(address string) error {
-	msg := fmt.Sprintf("{\"action\":\"Unsubscribe\",\"channel\":\"account:%s\"}", address)
-	ws.writeChannel <- msg
+	return ws.UnSubscribeBalanceChangeCtx(context.Background(), address)
+}
+
+func (ws *NdexWs) UnSubscribeBalanceChangeCtx(ctx context.Context, address string) error {
 	channel := fmt.Sprintf("account:%s", address)
-	wsSubInfo := ws.subscribeMap[channel]
-	close(wsSubInfo.Event.(chan *WsBalanceChange))
-	delete(ws.subscribeMap, channel)
-	return nil
+	return ws.unsubscribe(ctx, channel, unsubMessage(channel))
 }
 
-func (ws *NdexWs) reSubscribe() error {
-	for _, wsSubInfo := range ws.subscribeMap {
-		ws.writeChannel <- wsSubInfo.SubMessage
+func orderBookUnsubMessage(symbol string) string {
+	return fmt.Sprintf("{\"action\":\"Unsubscribe\",\"channel\":\"apiOrderBook:{\\\"symbol\\\":\\\"%s\\\"}\"}", symbol)
+}
+
+func unsubMessage(channel string) string {
+	return fmt.Sprintf("{\"action\":\"Unsubscribe\",\"channel\":\"%s\"}", channel)
+}
+
+// the subscription is registered before its message is sent, so no data can arrive ahead of it
+func (ws *NdexWs) subscribe(ctx context.Context, channel, msg, unsubMsg string, newEvent func() interface{}) (interface{}, error) {
+	sub, created := ws.subscriptions.getOrAdd(channel, msg, unsubMsg, newEvent)
+	if err := ws.send(ctx, msg); err != nil {
+		if created {
+			ws.subscriptions.removeIf(sub)
+		}
+		return nil, err
 	}
+	return sub.Event, nil
+}
+
+// the event channel is closed once no dispatch is sending on it, unsubscribing an unknown channel only sends msg
+func (ws *NdexWs) unsubscribe(ctx context.Context, channel, msg string) error {
+	if err := ws.send(ctx, msg); err != nil {
+		return err
+	}
+	ws.subscriptions.remove(channel)
 	return nil
 }
 
+/**
+ * Drop the current connection, the connection state machine reconnects and resubscribes with backoff
+ * 断开当前连接，由连接状态机按退避策略重新连接并重新订阅
+ */
 func (ws *NdexWs) ReConn() error {
-	log.Println("ndex reConning...")
-	err := ws.Conn()
-	if err != nil {
-		return err
+	ws.mu.Lock()
+	conn, state := ws.conn, ws.state
+	ws.mu.Unlock()
+	if state == ConnStateClosed {
+		return ErrWsClosed
 	}
-	err = ws.reSubscribe()
-	if err == nil {
-		log.Println("ndex reConn success.")
-	} else {
-		log.Println("ndex reConn error : ", err)
+	if conn != nil {
+		ws.connectionLost(conn, errors.New("reconnect requested"))
 	}
-	return err
+	return nil
 }
 
 func (ws *NdexWs) Conn() error {
-	url := fmt.Sprintf(ws.Host + "/ws")
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
-	if err != nil {
-		return err
-	}
+	return ws.ConnCtx(context.Background())
+}
 
-	if ws.subscribeMap== nil {
-		ws.subscribeMap = make(map[string]*WsSubInfo)
+/**
+ * Dial the websocket server, ctx bounds the handshake only. Lost connections are re-established by the state machine,
+ * see State and StateChanges
+ * 连接 websocket 服务器，ctx 仅限制握手过程。断开的连接由状态机重新建立，参见 State 及 StateChanges
+ */
+func (ws *NdexWs) ConnCtx(ctx context.Context) error {
+	ws.mu.Lock()
+	switch ws.state {
+	case ConnStateConnected, ConnStateReconnecting:
+		ws.mu.Unlock()
+		return nil
+	case ConnStateConnecting:
+		ws.mu.Unlock()
+		return errors.New("ndex websocket is already connecting")
 	}
-	ws.readChannel = make(chan string, 100)
-	ws.writeChannel = make(chan string, 10)
-	ws.done = make(chan struct{})
-	ws.conn = c
-
-	go ws.readHandler()
-	go ws.writeHandler()
-	go ws.pingHandler()
-	go ws.exitHandler()
-	go ws.messageHandler()
+	if ws.readChannel == nil {
+		ws.readChannel = make(chan string, 100)
+		ws.writeChannel = make(chan string, 10)
+	}
+	stopped := make(chan struct{})
+	ws.stopped = stopped
+	ws.closing = false
+	ws.setState(ConnStateConnecting, 0, nil)
+	ws.mu.Unlock()
 
+	if err := ws.dial(ctx, 0); err != nil {
+		ws.shutdown(err)
+		return err
+	}
+	ws.handlers.Add(1)
+	go ws.messageHandler(stopped)
 	return nil
 }
 
-func (ws *NdexWs) messageHandler() {
+func (ws *NdexWs) messageHandler(stopped chan struct{}) {
+	defer ws.handlers.Done()
 	for {
 		select {
-		case <- ws.done:
+		case <- stopped:
 			return
 		case message := <- ws.readChannel:
+			if message == resyncMarker {
+				ws.subscriptions.resync()
+				break
+			}
 			//log.Println("received message :  " + message)
 			wsResponse := &WsResponse{}
 			messageBytes := []byte(message)
 			err := json.Unmarshal(messageBytes, wsResponse)
 			if err != nil || wsResponse.Channel == "" {
-				wsPong := &WsPong{}
-				err = json.Unmarshal(messageBytes, wsPong)
-				if err == nil {
-					// processPong
-					ws.processPong(wsPong)
-				}
+				// pongs are taken by the reader and never get here
 				break
 			}
 			if wsResponse.Status == 200 {
@@ -209,19 +283,16 @@ func (ws *NdexWs) messageHandler() {
 				switch wsResponse.Channel {
 				case "apiOrderBook":
 					orderBookResponse := &WsOrderBookResponse{}
-					err = json.Unmarshal(messageBytes, orderBookResponse)
+					err = ws.decodeMessage("apiOrderBook", messageBytes, orderBookResponse)
 					if err != nil {
 						log.Println(err, ", [apiOrderBook] message : ", message)
 						break
 					}
 					symbol := orderBookResponse.Data.Symbol
-					wsSubInfo := ws.subscribeMap["apiOrderBook:" + symbol]
-					if wsSubInfo != nil {
-						wsSubInfo.Event.(chan *OrderBook) <- orderBookResponse.Data
-					}
+					ws.subscriptions.dispatch("apiOrderBook:" + symbol, orderBookResponse.Data)
 				case "order":
 					orderChangeResponse := &WsOrderChangeResponse{}
-					err = json.Unmarshal(messageBytes, orderChangeResponse)
+					err = ws.decodeMessage("order", messageBytes, orderChangeResponse)
 					if err != nil {
 						log.Println(err, ", [order] message : ", message)
 						break
@@ -229,41 +300,29 @@ func (ws *NdexWs) messageHandler() {
 					if orderChangeResponse.Data.T == "update" {
 						for _, order := range orderChangeResponse.Data.D {
 							channel := fmt.Sprintf("order:%s", order.Address)
-							wsSubInfo := ws.subscribeMap[channel]
-							if wsSubInfo == nil {
-								continue
-							}
 							orderList := []*Order{ order  }
 							orderChange := &WsOrderChange{
 								T:	orderChangeResponse.Data.T,
 								D:	orderList,
 							}
-							wsSubInfo.Event.(chan *WsOrderChange) <- orderChange
+							ws.subscriptions.dispatch(channel, orderChange)
 						}
 					} else if orderChangeResponse.Data.T == "init" {
 						if len(orderChangeResponse.Data.D) == 0 {
 							break
 						}
 						channel := fmt.Sprintf("order:%s", orderChangeResponse.Data.D[0].Address)
-						wsSubInfo := ws.subscribeMap[channel]
-						if wsSubInfo == nil {
-							continue
-						}
-						wsSubInfo.Event.(chan *WsOrderChange) <- orderChangeResponse.Data
+						ws.subscriptions.dispatch(channel, orderChangeResponse.Data)
 					}
 				case "account":
 					balanceChangeResponse := &WsBalanceChangeResponse{}
-					err = json.Unmarshal(messageBytes, balanceChangeResponse)
+					err = ws.decodeMessage("account", messageBytes, balanceChangeResponse)
 					if err != nil {
 						log.Println(err, ", [balance] message : ", message)
 						break
 					}
 					channel := fmt.Sprintf("account:%s", balanceChangeResponse.Data.A)
-					wsSubInfo := ws.subscribeMap[channel]
-					if wsSubInfo == nil {
-						continue
-					}
-					wsSubInfo.Event.(chan *WsBalanceChange) <- balanceChangeResponse.Data
+					ws.subscriptions.dispatch(channel, balanceChangeResponse.Data)
 				default:
 					log.Println("[NOTICE] Not yet parsed message : ", message)
 				}
@@ -274,77 +333,14 @@ func (ws *NdexWs) messageHandler() {
 	}
 }
 
-func (ws *NdexWs) readHandler() {
-	for {
-		select {
-		case <- ws.done:
-			log.Println("ndex websocket closing reader.")
-			return
-		default:
-			_, message, err := ws.conn.ReadMessage()
-			if err != nil {
-				log.Println("ndex websocket close, " + err.Error())
-				close(ws.done)
-				for {
-					err = ws.ReConn()
-					if err == nil {
-						break
-					}
-					time.Sleep(5*time.Second)
-				}
-				return
-			}
-			//log.Println("received message:  " + string(message))
-			ws.readChannel <- string(message)
-		}
-	}
-}
-
-func (ws *NdexWs) writeHandler() {
-	for {
-		select {
-		case <- ws.done:
-			return
-		case msg := <- ws.writeChannel:
-			if msg != "" {
-				err := ws.conn.WriteMessage(websocket.TextMessage, []byte(msg))
-				if err != nil {
-					//log.Println("write message error, now close the connection.", err)
-					//close(ws.done)
-					return
-				}
-			}
-		}
-	}
-}
-
-func (ws *NdexWs) pingHandler() {
-	ws.Ping()
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			ws.Ping()
-		case <- ws.done:
-			return
-		}
-	}
-}
-
-func (ws *NdexWs) exitHandler() {
-	defer ws.conn.Close()
-	defer close(ws.readChannel)
-	defer close(ws.writeChannel)
-	for {
-		select {
-		case <- ws.done:
-			log.Println("ndex websocket closed.")
-			return
+func (ws *NdexWs) decodeMessage(channel string, messageBytes []byte, v interface{}) error {
+	err := json.Unmarshal(messageBytes, v)
+	if err == nil && ws.StrictDecoding {
+		if report := checkStrict(messageBytes, v); report != nil {
+			report.Endpoint = channel
+			log.Println("[WARING] ", report)
 		}
 	}
+	return err
 }
 
-func (ws *NdexWs) processPong(pong *WsPong) {
-	// Do nothing
-}
@@ -39,7 +39,7 @@ var (
 )
 
 func init() {
-	host := "ws://beta.nervedex.com"
+	host := Beta().WsHost
 	ndexWs = &NdexWs{Host: host}
 	ndexWs.Conn()
 
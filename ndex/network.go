@@ -0,0 +1,250 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/16 下午2:10
+ */
+package ndex
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NerveNetwork/ndex-go-sdk/ndex/address"
+)
+
+/**
+ * A network profile: the servers of the exchange and the chain its addresses and assets belong to
+ * 网络配置：交易所的服务器地址及其地址和资产所属的链
+ */
+type Network struct {
+	Name			string
+	Host			string
+	WsHost			string
+	ChainId			uint16	// chain id of the addresses, also the asset chain id of assets issued on this chain
+	AddressPrefix	string
+	MainAssetId		uint16	// NVT, the fee asset, is asset MainAssetId of chain ChainId
+}
+
+var (
+	mainnet = Network{
+		Name:			"mainnet",
+		Host:			"https://api.nervedex.com",
+		WsHost:			"wss://api.nervedex.com",
+		ChainId:		address.MainnetChainId,
+		AddressPrefix:	address.MainnetPrefix,
+		MainAssetId:	1,
+	}
+	beta = Network{
+		Name:			"beta",
+		Host:			"http://beta.nervedex.com",
+		WsHost:			"ws://beta.nervedex.com",
+		ChainId:		address.TestnetChainId,
+		AddressPrefix:	address.TestnetPrefix,
+		MainAssetId:	1,
+	}
+)
+
+// presets that Market.Network recognises by host, never handed out by pointer
+var knownNetworks = []Network{mainnet, beta}
+
+/**
+ * The Nerve mainnet exchange, every call returns a new copy
+ * Nerve 主网交易所，每次调用返回新的副本
+ */
+func Mainnet() Network {
+	return mainnet
+}
+
+/**
+ * The beta exchange, every call returns a new copy
+ * 测试交易所，每次调用返回新的副本
+ */
+func Beta() Network {
+	return beta
+}
+
+/**
+ * Same as Beta, the beta exchange runs on the Nerve testnet
+ * 同 Beta，测试交易所运行在 Nerve 测试网上
+ */
+func Testnet() Network {
+	return beta
+}
+
+/**
+ * Describe a custom network, e.g. a local node, hosts must be set
+ * 描述自定义网络，例如本地节点，必须设置服务器地址
+ */
+func CustomNetwork(name, host, wsHost string, chainId uint16, addressPrefix string) Network {
+	return Network{Name: name, Host: host, WsHost: wsHost, ChainId: chainId, AddressPrefix: addressPrefix, MainAssetId: 1}
+}
+
+func (network *Network) validate() error {
+	if network.Host == "" || network.WsHost == "" {
+		return fmt.Errorf("network %s has no host", network.Name)
+	}
+	if network.ChainId == 0 {
+		return fmt.Errorf("network %s has no chain id", network.Name)
+	}
+	if network.AddressPrefix == "" {
+		return fmt.Errorf("network %s has no address prefix", network.Name)
+	}
+	return nil
+}
+
+/**
+ * Check that the address is well-formed and belongs to the chain of the network
+ * 检查地址格式正确且属于该网络的链
+ */
+func (network *Network) ValidateAddress(addr string) error {
+	parsed, err := address.Parse(addr)
+	if err != nil {
+		return err
+	}
+	if parsed.ChainId != network.ChainId || parsed.Prefix != network.AddressPrefix {
+		return fmt.Errorf("%w: %s belongs to chain %d, the %s network is chain %d", address.ErrInvalidAddress, addr, parsed.ChainId, network.Name, network.ChainId)
+	}
+	return nil
+}
+
+/**
+ * The normal address of a compressed public key on this network
+ * 压缩公钥在该网络上的普通地址
+ */
+func (network *Network) AddressFromPublicKey(publicKey []byte) (string, error) {
+	derived, err := address.FromPublicKey(publicKey, network.ChainId, network.AddressPrefix)
+	if err != nil {
+		return "", err
+	}
+	return derived.String(), nil
+}
+
+/**
+ * Whether the asset is the main asset of the network, which pays the fees
+ * 资产是否为该网络的主资产，即手续费资产
+ */
+func (network *Network) IsMainAsset(assetChainId, assetId uint16) bool {
+	return assetChainId == network.ChainId && assetId == network.MainAssetId
+}
+
+/**
+ * Select a network profile, unset hosts are taken from it and addresses and signers of other chains are rejected
+ * 选择网络配置，未设置的服务器地址取自该配置，其他链的地址和签名器会被拒绝
+ */
+func WithNetwork(network Network) Option {
+	return func(config *marketConfig) error {
+		if err := network.validate(); err != nil {
+			return err
+		}
+		config.market.network = &network
+		return nil
+	}
+}
+
+/**
+ * A copy of the network selected by WithNetwork, otherwise of the preset whose host is configured, nil for unknown hosts
+ * 通过 WithNetwork 选择的网络的副本，否则为服务器地址匹配的预设网络的副本，未知服务器返回 nil
+ */
+func (market *Market) Network() *Network {
+	if market.network != nil {
+		network := *market.network
+		return &network
+	}
+	for _, network := range knownNetworks {
+		if sameHost(market.Host, network.Host) {
+			return &network
+		}
+	}
+	return nil
+}
+
+// scheme and trailing slash do not matter, beta is served over http and https
+func sameHost(a, b string) bool {
+	trim := func(host string) string {
+		if i := strings.Index(host, "://"); i >= 0 {
+			host = host[i+3:]
+		}
+		return strings.TrimSuffix(host, "/")
+	}
+	return trim(a) == trim(b)
+}
+
+// apply the selected network: hosts, the address of the private key, and hosts of other presets are reported
+func (market *Market) applyNetwork() []error {
+	network := market.network
+	if network == nil {
+		return nil
+	}
+	if market.Host == "" {
+		market.Host = network.Host
+	}
+	if market.WsHost == "" {
+		market.WsHost = network.WsHost
+	}
+	var problems []error
+	for _, other := range knownNetworks {
+		if other.Name == network.Name {
+			continue
+		}
+		if sameHost(market.Host, other.Host) || sameHost(market.WsHost, other.WsHost) {
+			problems = append(problems, fmt.Errorf("network: the %s network is selected but the hosts belong to %s", network.Name, other.Name))
+		}
+	}
+	if market.Address == "" && market.PrivateKey != "" && market.signer == nil {
+		if derived, err := market.addressOfKey(market.PrivateKey); err == nil {
+			market.Address = derived
+		}
+	}
+	return problems
+}
+
+func (market *Market) addressOfKey(privateKey string) (string, error) {
+	network := market.Network()
+	if network == nil {
+		return "", errors.New("the network is unknown, set the address")
+	}
+	keyBytes, err := hex.DecodeString(privateKey)
+	if err != nil {
+		return "", errors.New("private key is not valid hex")
+	}
+	defer wipeBytes(keyBytes)
+	signer, err := newKeySigner("", keyBytes)
+	if err != nil {
+		return "", err
+	}
+	defer signer.Close()
+	return network.AddressFromPublicKey(signer.PublicKey())
+}
+
+// address.Validate, plus the chain check when the network is known
+func (market *Market) validateAddress(addr string) error {
+	if network := market.Network(); network != nil {
+		return network.ValidateAddress(addr)
+	}
+	return address.Validate(addr)
+}
@@ -0,0 +1,108 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/16 下午2:10
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NerveNetwork/ndex-go-sdk/ndex/address"
+)
+
+func TestNetwork_Presets(t *testing.T) {
+	m, err := NewMarket(WithNetwork(Beta()), WithPrivateKey(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Host != Beta().Host || m.WsHost != Beta().WsHost {
+		t.Errorf("hosts %s %s", m.Host, m.WsHost)
+	}
+	if m.Address != testAddress {
+		t.Errorf("address derived from the private key is %s", m.Address)
+	}
+	if !m.Network().IsMainAsset(5, 1) || m.Network().IsMainAsset(9, 1) {
+		t.Error("main asset of beta is 5-1")
+	}
+
+	// the presets and the network of a market can not be changed from outside
+	preset := Beta()
+	preset.Host = "http://127.0.0.1:8080"
+	m.Network().ChainId = 9
+	if Beta().Host == preset.Host || Testnet().Host != Beta().Host || m.Network().ChainId != 5 {
+		t.Error("a network profile was changed through a copy")
+	}
+	inferred := (&Market{Host: Mainnet().Host}).Network()
+	inferred.Host = preset.Host
+	if (&Market{Host: Mainnet().Host}).Network() == nil {
+		t.Error("a preset was changed through Market.Network")
+	}
+
+	// a testnet key on mainnet endpoints
+	if _, err := NewMarket(WithNetwork(Mainnet()), WithAddress(testAddress)); !errors.Is(err, address.ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+	if _, err := NewMarket(WithNetwork(Beta()), WithHost(Mainnet().Host)); err == nil {
+		t.Error("mainnet host was accepted for the beta network")
+	}
+	if _, err := NewMarket(WithAddress(testAddress)); err == nil {
+		t.Error("testnet address was accepted on the default mainnet host")
+	}
+}
+
+func TestNetwork_Inferred(t *testing.T) {
+	m := &Market{Host: "https://beta.nervedex.com/"}
+	if m.Network() == nil || m.Network().Name != Beta().Name {
+		t.Fatalf("network of %s is %v", m.Host, m.Network())
+	}
+	m = &Market{Host: "http://127.0.0.1:8080"}
+	if m.Network() != nil {
+		t.Errorf("network of %s is %v", m.Host, m.Network())
+	}
+	if err := m.validateAddress(testAddress); err != nil {
+		t.Error(err)
+	}
+	if _, err := m.GetBalanceByAddressCtx(context.Background(), "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giE"); !errors.Is(err, address.ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+}
+
+func TestNetwork_Custom(t *testing.T) {
+	local := CustomNetwork("local", "http://127.0.0.1:18003", "ws://127.0.0.1:18003", address.TestnetChainId, address.TestnetPrefix)
+	m, err := NewMarket(WithNetwork(local), WithAddress(testAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Host != local.Host || m.Network().Name != "local" {
+		t.Errorf("host %s network %v", m.Host, m.Network())
+	}
+	if _, err := NewMarket(WithNetwork(CustomNetwork("broken", "", "", 5, "TNVT"))); err == nil {
+		t.Error("network without hosts was accepted")
+	}
+}
@@ -0,0 +1,274 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/2 上午10:20
+ */
+package ndex
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * Option configures a Market created by NewMarket
+ * Option 用于配置 NewMarket 创建的 Market
+ */
+type Option func(*marketConfig) error
+
+type marketConfig struct {
+	market     *Market
+	httpClient *http.Client
+	transport  http.RoundTripper
+	tlsConfig  *tls.Config
+	proxy      func(*http.Request) (*url.URL, error)
+	header     map[string]string
+	userAgent  string
+}
+
+/**
+ * Create a market with the given options, unset hosts fall back to the defaults of Initialize, DefaultRetryPolicy and
+ * the default rate limits of WithRateLimit are used, nothing is requested from the server
+ * 使用指定的选项创建 Market，未设置的服务器地址使用 Initialize 中的默认值，默认使用 DefaultRetryPolicy 及 WithRateLimit 中的默认限流，
+ * 不会请求服务器
+ */
+func NewMarket(opts ...Option) (*Market, error) {
+	retryPolicy := DefaultRetryPolicy
+	config := &marketConfig{
+		market:    &Market{retryPolicy: &retryPolicy, limiters: defaultLimiters()},
+		header:    map[string]string{},
+		userAgent: utils.DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			config.market.releaseSigner()
+			return nil, err
+		}
+	}
+	if err := config.apply(); err != nil {
+		config.market.releaseSigner()
+		return nil, err
+	}
+	if err := config.market.Initialize(); err != nil {
+		config.market.releaseSigner()
+		return nil, err
+	}
+	return config.market, nil
+}
+
+func (config *marketConfig) apply() error {
+	if config.transport != nil && (config.tlsConfig != nil || config.proxy != nil) {
+		return errors.New("tls config and proxy can not be combined with a custom transport")
+	}
+	httpClient := &http.Client{}
+	if config.httpClient != nil {
+		// copy, so the caller's client is never modified
+		copied := *config.httpClient
+		httpClient = &copied
+	}
+	if config.transport != nil {
+		httpClient.Transport = config.transport
+	} else if httpClient.Transport == nil {
+		httpClient.Transport = utils.NewTransport(config.tlsConfig, config.proxy)
+	} else if config.tlsConfig != nil || config.proxy != nil {
+		return errors.New("tls config and proxy can not be combined with an http client that has its own transport")
+	}
+	client := utils.NewClient(httpClient)
+	client.Header = config.header
+	client.UserAgent = config.userAgent
+	config.market.client = client
+
+	// the websocket shares tls, proxy and headers with the rest client
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = config.tlsConfig
+	if config.proxy != nil {
+		dialer.Proxy = config.proxy
+	}
+	wsHeader := http.Header{}
+	for k, v := range config.header {
+		wsHeader.Set(k, v)
+	}
+	if config.userAgent != "" {
+		wsHeader.Set("User-Agent", config.userAgent)
+	}
+	config.market.wsDialer = &dialer
+	config.market.wsHeader = wsHeader
+
+	if config.market.localTxBuilding && len(config.market.symbols.pairs) == 0 {
+		return errors.New("local tx building needs the trading hash and asset ids of the traded pairs, /api/tradings does not return them: declare them with WithTradingPair")
+	}
+	if signer := config.market.signer; signer != nil {
+		if config.market.Address == "" {
+			config.market.Address = signer.Address()
+		} else if config.market.Address != signer.Address() {
+			return fmt.Errorf("signer address %s does not match the configured address %s", signer.Address(), config.market.Address)
+		}
+	}
+	return nil
+}
+
+func WithHost(host string) Option {
+	return func(config *marketConfig) error {
+		config.market.Host = host
+		return nil
+	}
+}
+
+func WithWsHost(wsHost string) Option {
+	return func(config *marketConfig) error {
+		config.market.WsHost = wsHost
+		return nil
+	}
+}
+
+func WithAddress(address string) Option {
+	return func(config *marketConfig) error {
+		config.market.Address = address
+		return nil
+	}
+}
+
+func WithPrivateKey(privateKey string) Option {
+	return func(config *marketConfig) error {
+		config.market.PrivateKey = privateKey
+		return nil
+	}
+}
+
+/**
+ * Use the given http client for every rest call
+ * 所有 rest 请求使用指定的 http client
+ */
+func WithHTTPClient(client *http.Client) Option {
+	return func(config *marketConfig) error {
+		if client == nil {
+			return errors.New("http client can not be nil")
+		}
+		config.httpClient = client
+		return nil
+	}
+}
+
+/**
+ * Use the given round tripper for every rest call
+ * 所有 rest 请求使用指定的 RoundTripper
+ */
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *marketConfig) error {
+		if transport == nil {
+			return errors.New("transport can not be nil")
+		}
+		config.transport = transport
+		return nil
+	}
+}
+
+/**
+ * Use the given tls config for rest and websocket connections, certificates are verified unless the config says otherwise
+ * rest 与 websocket 连接使用指定的 tls 配置，除非配置中另行指定，否则会校验证书
+ */
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(config *marketConfig) error {
+		config.tlsConfig = tlsConfig
+		return nil
+	}
+}
+
+/**
+ * Send rest and websocket traffic through the given proxy, e.g. http://127.0.0.1:8080
+ * rest 与 websocket 流量通过指定代理发送，例如 http://127.0.0.1:8080
+ */
+func WithProxy(proxyURL string) Option {
+	return func(config *marketConfig) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		config.proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+/**
+ * Add a header to every rest request and the websocket handshake
+ * 为每个 rest 请求及 websocket 握手添加请求头
+ */
+func WithHeader(key, value string) Option {
+	return func(config *marketConfig) error {
+		config.header[key] = value
+		return nil
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(config *marketConfig) error {
+		config.userAgent = userAgent
+		return nil
+	}
+}
+
+/**
+ * Set the delays between websocket reconnect attempts and give up after maxAttempts failures in a row, 0 retries forever
+ * 设置 websocket 重连的间隔，连续失败 maxAttempts 次后放弃，0 表示无限重试
+ */
+func WithWsReconnect(backoff utils.Backoff, maxAttempts int) Option {
+	return func(config *marketConfig) error {
+		if backoff.Initial <= 0 {
+			return errors.New("reconnect backoff must have a positive initial delay")
+		}
+		if maxAttempts < 0 {
+			return errors.New("max reconnect attempts can not be negative")
+		}
+		config.market.wsReconnectBackoff = &backoff
+		config.market.wsMaxReconnectAttempts = maxAttempts
+		return nil
+	}
+}
+
+/**
+ * Ping the websocket server every interval and reconnect once maxMissed pings in a row went unanswered
+ * 每隔 interval 向 websocket 服务器发送 ping，连续 maxMissed 次未收到 pong 时重新连接
+ */
+func WithWsHeartbeat(interval time.Duration, maxMissed int) Option {
+	return func(config *marketConfig) error {
+		if interval <= 0 {
+			return errors.New("ping interval must be positive")
+		}
+		if maxMissed <= 0 {
+			return errors.New("max missed pongs must be positive")
+		}
+		config.market.wsPingInterval = interval
+		config.market.wsMaxMissedPongs = maxMissed
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/2 上午10:40
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NerveNetwork/ndex-go-sdk/ndex/address"
+)
+
+type countingTransport struct {
+	calls int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewMarket_Options(t *testing.T) {
+	var userAgent, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		apiKey = r.Header.Get("X-Api-Key")
+		w.Write([]byte(`{"code":0,"success":true,"msg":"","data":1589271332077}`))
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	m, err := NewMarket(
+		WithHost(server.URL),
+		WithTransport(transport),
+		WithHeader("X-Api-Key", "secret"),
+		WithUserAgent("my-bot/1.0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.WsHost == "" {
+		t.Error("default websocket host was not set")
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := m.GetServeTimeCtx(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&transport.calls) != 3 {
+		t.Errorf("custom transport used %d times, want 3", transport.calls)
+	}
+	if userAgent != "my-bot/1.0" {
+		t.Errorf("user agent = %q", userAgent)
+	}
+	if apiKey != "secret" {
+		t.Errorf("custom header = %q", apiKey)
+	}
+}
+
+func TestNewMarket_TransportConflict(t *testing.T) {
+	_, err := NewMarket(WithTransport(&countingTransport{}), WithProxy("http://127.0.0.1:8080"))
+	if err == nil {
+		t.Fatal("expected proxy and custom transport to conflict")
+	}
+}
+
+func TestNewMarket_InvalidAddress(t *testing.T) {
+	if _, err := NewMarket(WithAddress("TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giE")); !errors.Is(err, address.ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+	if _, err := NewMarket(WithAddress("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA"), WithPrivateKey(testPrivateKey)); err == nil {
+		t.Error("private key of another address was accepted")
+	}
+	m := &Market{}
+	if _, err := m.GetBalanceByAddressCtx(context.Background(), "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giE"); !errors.Is(err, address.ErrInvalidAddress) {
+		t.Errorf("expected ErrInvalidAddress, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/18 下午3:20
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const DefaultOrderPageSize = 50
+
+/**
+ * Select the orders returned by IterateOrders, zero fields match everything except Symbol, which the server requires
+ * 筛选 IterateOrders 返回的订单，除服务器要求的 Symbol 外，零值字段不做筛选
+ */
+type OrderFilter struct {
+	Address		string			// empty uses the configured address
+	Symbol		string
+	Statuses	[]OrderStatus
+	Side		Side
+	Since		time.Time		// orders created at or after Since, paging stops at the first page entirely older
+	Until		time.Time		// orders created before Until
+	PageSize	int				// DefaultOrderPageSize if not set
+	Prefetch	bool			// request the next page while the current one is consumed
+}
+
+func (filter *OrderFilter) match(order *Order) bool {
+	if filter.Side != 0 && order.Type != filter.Side {
+		return false
+	}
+	if len(filter.Statuses) > 0 {
+		matched := false
+		for _, status := range filter.Statuses {
+			if order.Status == status {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	createdAt := order.CreatedAt()
+	if !filter.Since.IsZero() && createdAt.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !createdAt.Before(filter.Until) {
+		return false
+	}
+	return true
+}
+
+// whether every order of a page was created before Since
+func (filter *OrderFilter) olderThanSince(orders []*Order) bool {
+	if filter.Since.IsZero() {
+		return false
+	}
+	for _, order := range orders {
+		if order != nil && !order.CreatedAt().Before(filter.Since) {
+			return false
+		}
+	}
+	return true
+}
+
+type orderPage struct {
+	orders	[]*Order
+	err		error
+}
+
+/**
+ * OrderIterator walks the order history page by page, each order is returned once even if new orders shift it to a later page
+ * OrderIterator 逐页遍历订单历史，即使新订单使其移到后面的页，每个订单也只返回一次
+ */
+type OrderIterator struct {
+	market		*Market
+	ctx			context.Context
+	cancel		context.CancelFunc
+	filter		OrderFilter
+	pageNumber	int
+	pending		chan orderPage	// the prefetched next page
+	buffer		[]*Order
+	seen		map[string]bool
+	order		*Order
+	done		bool
+	err			error
+}
+
+/**
+ * Iterate the order history of an address lazily, pages are only requested as the iterator advances.
+ * Call Close when stopping before Next returns false.
+ * 惰性遍历地址的订单历史，仅在迭代推进时请求下一页。在 Next 返回 false 之前停止时需调用 Close
+ */
+func (market *Market) IterateOrders(ctx context.Context, filter OrderFilter) (*OrderIterator, error) {
+	if filter.Address == "" {
+		filter.Address = market.Address
+	}
+	if filter.Address == "" {
+		return nil, errors.New("No address is configured")
+	}
+	if err := market.validateAddress(filter.Address); err != nil {
+		return nil, err
+	}
+	if filter.Symbol == "" {
+		return nil, errors.New("symbol can not empty")
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = DefaultOrderPageSize
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &OrderIterator{
+		market:	market,
+		ctx:	ctx,
+		cancel:	cancel,
+		filter:	filter,
+		seen:	map[string]bool{},
+	}, nil
+}
+
+func (it *OrderIterator) fetch(pageNumber int) orderPage {
+	orderList, err := it.market.GetOrderListByAddressCtx(it.ctx, it.filter.Address, it.filter.Symbol, pageNumber, it.filter.PageSize)
+	if err != nil {
+		return orderPage{err: err}
+	}
+	if orderList == nil {
+		return orderPage{}
+	}
+	return orderPage{orders: orderList.Data}
+}
+
+func (it *OrderIterator) prefetch(pageNumber int) {
+	pending := make(chan orderPage, 1)
+	it.pending = pending
+	go func() {
+		pending <- it.fetch(pageNumber)
+	}()
+}
+
+// the next page, from the prefetch if one is running
+func (it *OrderIterator) nextPage() orderPage {
+	it.pageNumber++
+	if it.pending != nil {
+		pending := it.pending
+		it.pending = nil
+		return <-pending
+	}
+	return it.fetch(it.pageNumber)
+}
+
+/**
+ * Advance to the next matching order, false once the history is exhausted or a request failed, see Err
+ * 前进到下一个匹配的订单，历史遍历完成或请求失败时返回 false，参见 Err
+ */
+func (it *OrderIterator) Next() bool {
+	for {
+		for len(it.buffer) > 0 {
+			order := it.buffer[0]
+			it.buffer = it.buffer[1:]
+			// new orders push older ones onto the next page, which then repeats them
+			if order == nil || it.seen[order.Id] {
+				continue
+			}
+			it.seen[order.Id] = true
+			if it.filter.match(order) {
+				it.order = order
+				return true
+			}
+		}
+		if it.done {
+			it.order = nil
+			it.cancel()
+			return false
+		}
+		page := it.nextPage()
+		if page.err != nil {
+			it.err = page.err
+			it.Close()
+			return false
+		}
+		// a short page is the last one, the total may change while iterating so it is not trusted.
+		// the history is newest first, so after a page entirely older than Since nothing can match
+		if len(page.orders) < it.filter.PageSize || it.filter.olderThanSince(page.orders) {
+			it.done = true
+		} else if it.filter.Prefetch {
+			it.prefetch(it.pageNumber + 1)
+		}
+		it.buffer = page.orders
+	}
+}
+
+// the order Next advanced to
+func (it *OrderIterator) Order() *Order {
+	return it.order
+}
+
+// the error that stopped the iteration, nil when the history was exhausted
+func (it *OrderIterator) Err() error {
+	return it.err
+}
+
+/**
+ * Stop the iteration and cancel a running prefetch
+ * 停止遍历并取消正在进行的预取
+ */
+func (it *OrderIterator) Close() {
+	it.done = true
+	it.buffer = nil
+	it.cancel()
+}
@@ -0,0 +1,238 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/18 下午3:20
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a paged order history, newest first; insert runs before each page is served so tests can shift the history
+type orderHistoryServer struct {
+	mu		sync.Mutex
+	orders	[]*Order
+	pages	[]int
+	insert	func(page int) *Order
+	failAt	int
+}
+
+func (history *orderHistoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		PageNumber	int	`json:"pageNumber"`
+		PageSize	int	`json:"pageSize"`
+	}
+	json.NewDecoder(r.Body).Decode(&params)
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	history.pages = append(history.pages, params.PageNumber)
+	if params.PageNumber == history.failAt {
+		w.Write([]byte(`{"code":1,"success":false,"msg":"stop here"}`))
+		return
+	}
+	if history.insert != nil {
+		if order := history.insert(params.PageNumber); order != nil {
+			history.orders = append([]*Order{order}, history.orders...)
+		}
+	}
+	from := (params.PageNumber - 1) * params.PageSize
+	to := from + params.PageSize
+	if from > len(history.orders) {
+		from = len(history.orders)
+	}
+	if to > len(history.orders) {
+		to = len(history.orders)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": &OrderList{Data: history.orders[from:to], Total: len(history.orders)},
+	})
+}
+
+func testOrderHistory(n int) []*Order {
+	orders := make([]*Order, n)
+	for i := range orders {
+		orders[i] = &Order{
+			Id: fmt.Sprintf("order-%d", n - i),
+			Symbol: "NVTNULS",
+			Type: Side(i % 2 + 1),
+			Status: OrderStatus(i % 3 + 1),
+			CreateTime: int64(1589269000000 + (n - i) * 1000),
+		}
+	}
+	return orders
+}
+
+func collectOrders(t *testing.T, m *Market, filter OrderFilter) ([]string, error) {
+	it, err := m.IterateOrders(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Order().Id)
+	}
+	return ids, it.Err()
+}
+
+func TestMarket_IterateOrders(t *testing.T) {
+	history := &orderHistoryServer{orders: testOrderHistory(7)}
+	// every page after the first sees one new order pushing the history back
+	history.insert = func(page int) *Order {
+		if page < 2 {
+			return nil
+		}
+		return &Order{Id: fmt.Sprintf("new-%d", page), Type: SideBuy, Status: OrderStatusOpen}
+	}
+	server := httptest.NewServer(history)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	ids, err := collectOrders(t, m, OrderFilter{Symbol: "NVTNULS", PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	for _, id := range ids {
+		seen[id]++
+	}
+	for i := 1; i <= 7; i++ {
+		if id := fmt.Sprintf("order-%d", i); seen[id] != 1 {
+			t.Errorf("%s returned %d times", id, seen[id])
+		}
+	}
+	if len(ids) != len(seen) {
+		t.Errorf("duplicates in %v", ids)
+	}
+}
+
+func TestMarket_IterateOrdersFilter(t *testing.T) {
+	server := httptest.NewServer(&orderHistoryServer{orders: testOrderHistory(12)})
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	ids, err := collectOrders(t, m, OrderFilter{
+		Symbol: "NVTNULS",
+		Statuses: []OrderStatus{OrderStatusOpen, OrderStatusFilled},
+		Side: SideBuy,
+		Since: fromMillis(1589269003000),
+		Until: fromMillis(1589269011000),
+		PageSize: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// buys are at even positions, open or filled at positions 0 and 2 mod 3, created between order-3 and order-10
+	expected := []string{"order-10", "order-6", "order-4"}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", ids, expected)
+	}
+}
+
+func TestMarket_IterateOrdersPrefetch(t *testing.T) {
+	history := &orderHistoryServer{orders: testOrderHistory(10)}
+	server := httptest.NewServer(history)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	it, err := m.IterateOrders(context.Background(), OrderFilter{Symbol: "NVTNULS", PageSize: 4, Prefetch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	// the second page is requested while the first is still consumed
+	deadline := time.Now().Add(time.Second)
+	for {
+		history.mu.Lock()
+		pages := len(history.pages)
+		history.mu.Unlock()
+		if pages == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pages requested", pages)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 10 {
+		t.Errorf("%d orders, %v", n, it.Err())
+	}
+	if fmt.Sprint(history.pages) != "[1 2 3]" {
+		t.Errorf("pages requested %v", history.pages)
+	}
+}
+
+func TestMarket_IterateOrdersError(t *testing.T) {
+	server := httptest.NewServer(&orderHistoryServer{orders: testOrderHistory(10), failAt: 2})
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	ids, err := collectOrders(t, m, OrderFilter{Symbol: "NVTNULS", PageSize: 4})
+	if err == nil || len(ids) != 4 {
+		t.Errorf("%d orders, %v", len(ids), err)
+	}
+	if _, err := m.IterateOrders(context.Background(), OrderFilter{}); err == nil {
+		t.Error("missing symbol was accepted")
+	}
+}
+
+func TestMarket_IterateOrdersSinceStopsPaging(t *testing.T) {
+	history := &orderHistoryServer{orders: testOrderHistory(30)}
+	server := httptest.NewServer(history)
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress))
+	ids, err := collectOrders(t, m, OrderFilter{
+		Symbol: "NVTNULS",
+		Since: fromMillis(1589269022000),
+		PageSize: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 9 || ids[0] != "order-30" || ids[8] != "order-22" {
+		t.Errorf("got %v", ids)
+	}
+	// the third page is entirely older than Since, the remaining three are never requested
+	if fmt.Sprint(history.pages) != "[1 2 3]" {
+		t.Errorf("pages requested %v", history.pages)
+	}
+}
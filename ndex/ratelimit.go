@@ -0,0 +1,123 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 上午10:40
+ */
+package ndex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+/**
+ * EndpointClass groups endpoints that share a rate limit bucket
+ * EndpointClass 对共享同一个限流桶的接口进行分组
+ */
+type EndpointClass int
+
+const (
+	ClassPublic		EndpointClass = iota	// market data: time, symbols, ticker, kline, order book
+	ClassAccount							// account queries: balance, open orders, order list, order detail
+	ClassOrder								// order and cancel building, broadcast
+)
+
+func (c EndpointClass) String() string {
+	switch c {
+	case ClassPublic:
+		return "public"
+	case ClassAccount:
+		return "account"
+	case ClassOrder:
+		return "order"
+	}
+	return fmt.Sprintf("EndpointClass(%d)", int(c))
+}
+
+// buckets NewMarket installs, kept well below what a busy bot would send so the gateway does not throttle it
+var defaultRateLimits = map[EndpointClass]struct {
+	ratePerSecond	float64
+	burst			int
+}{
+	ClassPublic:	{20, 40},
+	ClassAccount:	{10, 20},
+	ClassOrder:		{5, 10},
+}
+
+func defaultLimiters() map[EndpointClass]*utils.RateLimiter {
+	limiters := make(map[EndpointClass]*utils.RateLimiter, len(defaultRateLimits))
+	for class, limit := range defaultRateLimits {
+		limiters[class] = utils.NewRateLimiter(limit.ratePerSecond, limit.burst)
+	}
+	return limiters
+}
+
+/**
+ * Limit the calls of an endpoint class to ratePerSecond with the given burst. Rest requests and websocket
+ * subscriptions of the same class share the bucket, each retry attempt takes a token as well. NewMarket limits public
+ * calls to 20 per second (burst 40), account queries to 10 (burst 20) and orders to 5 (burst 10), this replaces the
+ * bucket of class.
+ * 将某类接口的调用限制为每秒 ratePerSecond 次，允许 burst 次突发。同类的 rest 请求和 websocket 订阅共享同一个令牌桶，每次重试同样消耗令牌。
+ * NewMarket 默认将公共接口限制为每秒 20 次（突发 40），账户查询 10 次（突发 20），下单 5 次（突发 10），此选项替换 class 对应的令牌桶。
+ */
+func WithRateLimit(class EndpointClass, ratePerSecond float64, burst int) Option {
+	return func(config *marketConfig) error {
+		if ratePerSecond <= 0 {
+			return fmt.Errorf("rate limit of %s must be positive", class)
+		}
+		if config.market.limiters == nil {
+			config.market.limiters = map[EndpointClass]*utils.RateLimiter{}
+		}
+		config.market.limiters[class] = utils.NewRateLimiter(ratePerSecond, burst)
+		return nil
+	}
+}
+
+/**
+ * Wait time and rejection metrics of every configured bucket
+ * 所有已配置限流桶的等待时间和拒绝次数统计
+ */
+func (market *Market) RateLimitStats() map[EndpointClass]utils.RateLimiterStats {
+	stats := make(map[EndpointClass]utils.RateLimiterStats, len(market.limiters))
+	for class, limiter := range market.limiters {
+		stats[class] = limiter.Stats()
+	}
+	return stats
+}
+
+// block until the bucket of class has a token, fails fast with utils.ErrRateLimitWait under a too short deadline
+func (market *Market) waitLimiter(ctx context.Context, class EndpointClass) error {
+	limiter := market.limiters[class]
+	if limiter == nil {
+		return nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%s endpoints: %w", class, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 上午11:40
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+func TestMarket_RateLimitPerClass(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"success":true,"msg":"","data":[]}`))
+	}))
+	defer server.Close()
+
+	m, err := NewMarket(WithHost(server.URL), WithRateLimit(ClassPublic, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetSymbolsCtx(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+	defer cancel()
+	if _, err := m.GetSymbolsCtx(ctx); !errors.Is(err, utils.ErrRateLimitWait) {
+		t.Fatalf("second public call: err = %v", err)
+	}
+	// account calls use another bucket
+	if _, err := m.GetBalanceByAddressCtx(ctx, "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD"); err != nil {
+		t.Fatal(err)
+	}
+	stats := m.RateLimitStats()[ClassPublic]
+	if stats.Requests != 1 || stats.Rejected != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestNewMarket_DefaultRateLimits(t *testing.T) {
+	m, _ := NewMarket()
+	stats := m.RateLimitStats()
+	for _, class := range []EndpointClass{ClassPublic, ClassAccount, ClassOrder} {
+		if _, ok := stats[class]; !ok {
+			t.Errorf("no default bucket for %s", class)
+		}
+	}
+	// a burst beyond the default public bucket waits
+	for i := 0; i < defaultRateLimits[ClassPublic].burst; i++ {
+		if err := m.waitLimiter(context.Background(), ClassPublic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := m.waitLimiter(ctx, ClassPublic); !errors.Is(err, utils.ErrRateLimitWait) {
+		t.Errorf("public call after the burst: err = %v", err)
+	}
+	// and is replaced by WithRateLimit
+	m, _ = NewMarket(WithRateLimit(ClassPublic, 1000, 1000))
+	for i := 0; i < 100; i++ {
+		if err := m.waitLimiter(context.Background(), ClassPublic); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 下午2:40
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+/**
+ * RemoteSigner asks a signing service for signatures, the private key never leaves that service.
+ * The protocol is plain json over http:
+ *   GET  {url}/account  ->  {"address":"TNVTd...","publicKey":"02ab..."}
+ *   POST {url}/sign     {"address":"TNVTd...","hash":"9f1c..."}  ->  {"signature":"3045..."}
+ * Any status other than 200 is a failure, the body may carry {"error":"..."}. SignerHandler serves this protocol.
+ * RemoteSigner 向签名服务请求签名，私钥不会离开该服务。协议为 http 上的 json，见上文；SignerHandler 实现了服务端。
+ */
+type RemoteSigner struct {
+	url       string
+	client    *utils.Client
+	address   string
+	publicKey []byte
+}
+
+type signerAccount struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
+}
+
+// the body of POST /sign, shared by RemoteSigner and SignerHandler
+type signRequest struct {
+	Address string `json:"address"`
+	Hash    string `json:"hash"`
+}
+
+type signResponse struct {
+	Signature string `json:"signature"`
+}
+
+type signerError struct {
+	Error string `json:"error"`
+}
+
+/**
+ * Connect to the signing service at url and load its account, a nil client uses utils.DefaultClient.
+ * Set client.Header to authenticate against the service.
+ * 连接 url 处的签名服务并获取账户信息，client 为 nil 时使用 utils.DefaultClient。可通过 client.Header 设置认证信息。
+ */
+func NewRemoteSigner(ctx context.Context, url string, client *utils.Client) (*RemoteSigner, error) {
+	if client == nil {
+		client = utils.DefaultClient
+	}
+	signer := &RemoteSigner{url: strings.TrimRight(url, "/"), client: client}
+	responseBytes, err := client.Get(ctx, signer.url + "/account")
+	if err != nil {
+		return nil, remoteSignerError("account", err)
+	}
+	account := &signerAccount{}
+	if err := json.Unmarshal(responseBytes, account); err != nil {
+		return nil, err
+	}
+	publicKey, err := hex.DecodeString(account.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer returned an invalid public key: %w", err)
+	}
+	if !addressMatchesKey(account.Address, publicKey) {
+		return nil, fmt.Errorf("remote signer public key does not belong to %s", account.Address)
+	}
+	signer.address = account.Address
+	signer.publicKey = publicKey
+	return signer, nil
+}
+
+func (signer *RemoteSigner) Address() string {
+	return signer.address
+}
+
+func (signer *RemoteSigner) PublicKey() []byte {
+	return append([]byte(nil), signer.publicKey...)
+}
+
+func (signer *RemoteSigner) Sign(hash []byte) ([]byte, error) {
+	return signer.SignCtx(context.Background(), hash)
+}
+
+func (signer *RemoteSigner) SignCtx(ctx context.Context, hash []byte) ([]byte, error) {
+	request := &signRequest{Address: signer.address, Hash: hex.EncodeToString(hash)}
+	responseBytes, err := signer.client.PostJson(ctx, signer.url + "/sign", request)
+	if err != nil {
+		return nil, remoteSignerError("sign", err)
+	}
+	response := &signResponse{}
+	if err := json.Unmarshal(responseBytes, response); err != nil {
+		return nil, err
+	}
+	signature, err := hex.DecodeString(response.Signature)
+	if err != nil || len(signature) == 0 {
+		return nil, errors.New("remote signer returned an invalid signature")
+	}
+	return signature, nil
+}
+
+func remoteSignerError(action string, err error) error {
+	var httpError *utils.HttpError
+	if errors.As(err, &httpError) {
+		body := &signerError{}
+		if json.Unmarshal(httpError.Body, body) == nil && body.Error != "" {
+			return fmt.Errorf("remote signer %s: %s (http %d)", action, body.Error, httpError.StatusCode)
+		}
+	}
+	return fmt.Errorf("remote signer %s: %w", action, err)
+}
+
+/**
+ * Serve the RemoteSigner protocol for signer, mount it behind your own authentication
+ * 为 signer 提供 RemoteSigner 协议的服务端实现，请在其前面加上自己的认证
+ */
+func SignerHandler(signer Signer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeSignerError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeSignerJSON(w, &signerAccount{Address: signer.Address(), PublicKey: hex.EncodeToString(signer.PublicKey())})
+	})
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeSignerError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1024))
+		if err != nil {
+			writeSignerError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		request := &signRequest{}
+		if err := json.Unmarshal(body, request); err != nil {
+			writeSignerError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		if request.Address != signer.Address() {
+			writeSignerError(w, http.StatusBadRequest, "unknown address " + request.Address)
+			return
+		}
+		hash, err := hex.DecodeString(request.Hash)
+		if err != nil || len(hash) != 32 {
+			writeSignerError(w, http.StatusBadRequest, "hash must be 32 bytes of hex")
+			return
+		}
+		signature, err := signer.Sign(hash)
+		if err != nil {
+			writeSignerError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeSignerJSON(w, &signResponse{Signature: hex.EncodeToString(signature)})
+	})
+	return mux
+}
+
+func writeSignerJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeSignerError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&signerError{Error: message})
+}
@@ -0,0 +1,123 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/4 上午11:30
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+/**
+ * RetryPolicy controls how a single rest request is retried after a transient failure. A retry only repeats that
+ * request with the same payload, so an order build or the broadcast of one signed tx hex may be sent twice, but an
+ * order is never re-signed and placed twice.
+ * RetryPolicy 控制单个 rest 请求在临时故障后的重试，重试只会用相同参数重发该请求，订单不会被重新签名、重复下单。
+ */
+type RetryPolicy struct {
+	MaxAttempts	int		// total attempts including the first one, values below 2 disable retry
+	Backoff		utils.Backoff
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff: utils.Backoff{
+		Initial:	200 * time.Millisecond,
+		Max:		5 * time.Second,
+		Multiplier:	2,
+		Jitter:		0.2,
+	},
+}
+
+/**
+ * Report whether err is worth retrying: network failures, 5xx and rate limit responses
+ * 判断错误是否值得重试：网络故障、5xx 以及限流响应
+ */
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrServerUnavailable) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) {
+		return true
+	}
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+/**
+ * Replace DefaultRetryPolicy, RetryPolicy{MaxAttempts: 1} disables retry
+ * 替换 DefaultRetryPolicy，RetryPolicy{MaxAttempts: 1} 表示不重试
+ */
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(config *marketConfig) error {
+		config.market.retryPolicy = &policy
+		return nil
+	}
+}
+
+// run fn until it succeeds, fails permanently or the policy is exhausted, attempt starts at 1
+func (market *Market) withRetry(ctx context.Context, fn func(attempt int) error) error {
+	// a market built as a struct literal has no policy and retries like one built by NewMarket
+	policy := market.retryPolicy
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+	maxAttempts, backoff := policy.MaxAttempts, policy.Backoff
+	attempt := 1
+	for {
+		err := fn(attempt)
+		if err == nil || attempt >= maxAttempts || !IsRetryable(err) {
+			return err
+		}
+		delay := backoff.Duration(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			// the next attempt could not finish in time
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <- ctx.Done():
+			timer.Stop()
+			return err
+		case <- timer.C:
+		}
+		attempt++
+	}
+}
@@ -0,0 +1,158 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/4 下午2:00
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff: utils.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2, Jitter: 0.5},
+}
+
+func TestMarket_RetryTransientFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":0,"success":true,"msg":"","data":{"symbol":"NVTNULS","last":1.5}}`))
+	}))
+	defer server.Close()
+
+	m, err := NewMarket(WithHost(server.URL), WithRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticker, err := m.GetTickerCtx(context.Background(), "NVTNULS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Symbol != "NVTNULS" || calls != 3 {
+		t.Errorf("ticker %+v after %d calls", ticker, calls)
+	}
+}
+
+func TestMarket_StructLiteralRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":0,"success":true,"msg":"","data":{"symbol":"NVTNULS","last":1.5}}`))
+	}))
+	defer server.Close()
+
+	// built the way the README shows, DefaultRetryPolicy applies
+	m := &Market{Host: server.URL}
+	if _, err := m.GetTickerCtx(context.Background(), "NVTNULS"); err != nil || calls != 2 {
+		t.Errorf("%v after %d calls", err, calls)
+	}
+}
+
+func TestMarket_NoRetryOnPermanentFailure(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"code":1001,"success":false,"msg":"insufficient balance"}`))
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithRetryPolicy(testRetryPolicy))
+	_, err := m.GetOrderBookCtx(context.Background(), "NVTNULS", 10)
+	if !errors.Is(err, ErrInsufficientBalance) || calls != 1 {
+		t.Errorf("err = %v after %d calls", err, calls)
+	}
+}
+
+func TestMarket_BroadcastRetrySendsSameTx(t *testing.T) {
+	var calls int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(buf))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the node accepted the tx but the response never arrived
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"code":1,"success":false,"msg":"tx already exists"}`))
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithRetryPolicy(testRetryPolicy))
+	tx := &txprotocal.Transaction{TxType: 229, Time: 1589271332, SignData: []byte{1, 2, 3}}
+	txHash, err := m.broadcast(context.Background(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txHash != tx.GetHash().String() {
+		t.Errorf("tx hash = %s, want %s", txHash, tx.GetHash().String())
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] {
+		t.Errorf("broadcast payloads differ: %v", bodies)
+	}
+}
+
+func TestMarket_BroadcastRetryNonceOfPlacedOrder(t *testing.T) {
+	tx := &txprotocal.Transaction{TxType: TxTypeTradingOrder, Time: 1589271332, SignData: []byte{1, 2, 3}}
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/order/"+tx.GetHash().String() {
+			w.Write([]byte(`{"code":0,"success":true,"msg":"success","data":{"id":"` + tx.GetHash().String() + `","status":1}}`))
+			return
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the node accepted the order but the response never arrived
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"code":1,"success":false,"msg":"invalid nonce"}`))
+	}))
+	defer server.Close()
+
+	m, _ := NewMarket(WithHost(server.URL), WithRetryPolicy(testRetryPolicy))
+	txHash, err := m.broadcast(context.Background(), tx)
+	if err != nil || txHash != tx.GetHash().String() {
+		t.Errorf("a placed order was reported as failed: %s %v", txHash, err)
+	}
+}
@@ -0,0 +1,260 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 上午10:00
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/NerveNetwork/ndex-go-sdk/ndex/address"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/niels1286/nuls-go-sdk/crypto/eckey"
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+	"github.com/niels1286/nuls-go-sdk/utils/seria"
+)
+
+/**
+ * Signer signs transaction hashes for one address, implementations can keep the private key out of the process
+ * Signer 为一个地址签名交易hash，实现方可以将私钥保存在进程之外
+ */
+type Signer interface {
+	// the address the signatures belong to
+	Address() string
+	// the compressed public key of the address
+	PublicKey() []byte
+	// sign a 32 byte transaction hash, the result is a DER encoded signature
+	Sign(hash []byte) ([]byte, error)
+}
+
+/**
+ * ContextSigner is implemented by signers that can be cancelled, such as RemoteSigner
+ * ContextSigner 由可取消的签名器实现，例如 RemoteSigner
+ */
+type ContextSigner interface {
+	Signer
+	SignCtx(ctx context.Context, hash []byte) ([]byte, error)
+}
+
+/**
+ * KeySigner keeps the private key in memory until Close wipes it
+ * KeySigner 将私钥保存在内存中，直到 Close 将其清除
+ */
+type KeySigner struct {
+	mu			sync.RWMutex
+	address		string
+	privateKey	*btcec.PrivateKey
+	publicKey	[]byte
+}
+
+/**
+ * Create an in-memory signer from a hex private key, the key must belong to the address
+ * 使用hex格式的私钥创建内存签名器，私钥必须与地址匹配
+ */
+func NewKeySigner(address, privateKeyHex string) (*KeySigner, error) {
+	privateKey, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return nil, errors.New("private key is not valid hex")
+	}
+	defer wipeBytes(privateKey)
+	return NewKeySignerFromBytes(address, privateKey)
+}
+
+/**
+ * Create an in-memory signer from raw key bytes, the signer keeps its own copy so the caller may wipe privateKey afterwards
+ * 使用私钥字节创建内存签名器，签名器持有自己的副本，调用方随后可以清除 privateKey
+ */
+func NewKeySignerFromBytes(address string, privateKey []byte) (*KeySigner, error) {
+	if address == "" {
+		return nil, errors.New("address can not empty")
+	}
+	return newKeySigner(address, privateKey)
+}
+
+// an empty address is only used by CancelOrderByAddress, which never knew the address of the key
+func newKeySigner(address string, privateKey []byte) (*KeySigner, error) {
+	if len(privateKey) != 32 {
+		return nil, fmt.Errorf("private key must be 32 bytes, got %d", len(privateKey))
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), privateKey)
+	if key.D.Sign() == 0 || key.D.Cmp(btcec.S256().N) >= 0 {
+		return nil, errors.New("private key is out of range")
+	}
+	publicKey := key.PubKey().SerializeCompressed()
+	if address != "" && !addressMatchesKey(address, publicKey) {
+		wipeKey(key)
+		return nil, fmt.Errorf("private key does not belong to address %s", address)
+	}
+	return &KeySigner{address: address, privateKey: key, publicKey: publicKey}, nil
+}
+
+func (signer *KeySigner) Address() string {
+	return signer.address
+}
+
+func (signer *KeySigner) PublicKey() []byte {
+	return append([]byte(nil), signer.publicKey...)
+}
+
+func (signer *KeySigner) Sign(hash []byte) ([]byte, error) {
+	signer.mu.RLock()
+	defer signer.mu.RUnlock()
+	if signer.privateKey == nil {
+		return nil, ErrSignerClosed
+	}
+	signature, err := signer.privateKey.Sign(hash)
+	if err != nil {
+		return nil, err
+	}
+	return signature.Serialize(), nil
+}
+
+/**
+ * Wipe the private key, later calls of Sign fail with ErrSignerClosed
+ * 清除私钥，之后调用 Sign 将返回 ErrSignerClosed
+ */
+func (signer *KeySigner) Close() error {
+	signer.mu.Lock()
+	defer signer.mu.Unlock()
+	if signer.privateKey != nil {
+		wipeKey(signer.privateKey)
+		signer.privateKey = nil
+	}
+	return nil
+}
+
+func wipeKey(key *btcec.PrivateKey) {
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+}
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// compare the hash160 in the address with the one of the public key, the prefix only names the chain and is not checked
+func addressMatchesKey(addr string, publicKey []byte) bool {
+	parsed, err := address.Parse(addr)
+	return err == nil && parsed.MatchesPublicKey(publicKey)
+}
+
+// the 23 raw bytes of addr as stored in coin data and txData
+func addressBytes(addr string) ([]byte, error) {
+	parsed, err := address.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Bytes(), nil
+}
+
+// readable form of raw address bytes for error messages
+func formatAddress(raw []byte) string {
+	if len(raw) == address.BytesLength {
+		prefix, ok := address.PrefixOf(uint16(raw[0]) | uint16(raw[1])<<8)
+		if parsed, err := address.FromBytes(raw, prefix); ok && err == nil {
+			return parsed.String()
+		}
+	}
+	return fmt.Sprintf("%x", raw)
+}
+
+/**
+ * Sign the hash of tx with signer and attach the signature
+ * 使用 signer 对交易hash签名并附加签名数据
+ */
+func signTx(ctx context.Context, signer Signer, tx *txprotocal.Transaction) error {
+	hash, err := tx.GetHash().Serialize()
+	if err != nil {
+		return err
+	}
+	var signature []byte
+	if contextSigner, ok := signer.(ContextSigner); ok {
+		signature, err = contextSigner.SignCtx(ctx, hash)
+	} else {
+		signature, err = signer.Sign(hash)
+	}
+	if err != nil {
+		return fmt.Errorf("sign tx %s: %w", tx.GetHash().String(), err)
+	}
+	publicKey := signer.PublicKey()
+	if address := signer.Address(); address != "" && !addressMatchesKey(address, publicKey) {
+		return fmt.Errorf("sign tx %s: public key of the signer does not belong to %s", tx.GetHash().String(), signer.Address())
+	}
+	// a remote signer is trusted with the hash only, never with what ends up in the tx
+	verifyKey, err := eckey.FromPubKeyBytes(publicKey)
+	if err != nil || !verifyKey.Verify(hash, signature) {
+		return fmt.Errorf("sign tx %s: signature does not verify against the public key of %s", tx.GetHash().String(), signer.Address())
+	}
+	sign := txprotocal.P2PHKSignature{
+		SignValue: signature,
+		PublicKey: publicKey,
+	}
+	writer := seria.NewByteBufWriter()
+	writer.WriteBytesWithLen(sign.PublicKey)
+	writer.WriteBytesWithLen(sign.SignValue)
+	tx.SignData = writer.Serialize()
+	return nil
+}
+
+/**
+ * Sign orders and cancellations with signer, the address of the market is taken from the signer when it is not set
+ * 使用 signer 签名下单和撤单交易，未设置地址时使用 signer 的地址
+ */
+func WithSigner(signer Signer) Option {
+	return func(config *marketConfig) error {
+		if signer == nil {
+			return errors.New("signer can not be nil")
+		}
+		config.market.setSigner(signer, false)
+		return nil
+	}
+}
+
+// owned signers were unlocked by the market and are closed with it, signers passed in by the caller are left alone
+func (market *Market) setSigner(signer Signer, owned bool) {
+	market.releaseSigner()
+	market.signer = signer
+	market.signerOwned = owned
+}
+
+// wipe the key of an owned signer
+func (market *Market) releaseSigner() {
+	if closer, ok := market.signer.(io.Closer); ok && market.signerOwned {
+		closer.Close()
+	}
+	market.signerOwned = false
+}
@@ -0,0 +1,210 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 下午4:30
+ */
+package ndex
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+	"github.com/niels1286/nuls-go-sdk/crypto/eckey"
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+	"github.com/niels1286/nuls-go-sdk/utils/seria"
+)
+
+const (
+	testAddress    = "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD"
+	testPrivateKey = "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df"
+)
+
+// a fake ndex server that builds the unsigned tx the request asks for, lets tamper modify it and records the broadcast tx
+func newSigningServer(t *testing.T, broadcasted *string, tamper func(*DecodedTx)) *httptest.Server {
+	return newSigningServerWith(t, "synthetic_tradings.json", broadcasted, tamper)
+}
+
+// same as newSigningServer, /api/tradings serves the given testdata file
+func newSigningServerWith(t *testing.T, tradings string, broadcasted *string, tamper func(*DecodedTx)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params := map[string]interface{}{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		decoder.Decode(&params)
+		switch r.URL.Path {
+		case "/api/tradings":
+			serveTestdata(t, w, tradings)
+		case "/api/order", "/api/cancelOrder":
+			decoded := buildTestTx(r.URL.Path, params)
+			if tamper != nil {
+				tamper(decoded)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": encodeTestTx(decoded)})
+		case "/api/broadcast":
+			*broadcasted = params["txHex"].(string)
+			w.Write([]byte(`{"code":0,"success":true,"msg":"success","data":"82ad1756b22f480195c3f7eee5dfe2cf43e661b404f828255903cedb70172e40"}`))
+		}
+	}))
+}
+
+// the tx must carry a signature of its own hash by the public key of the test address
+func verifyBroadcastTx(t *testing.T, txHex string) {
+	txBytes, err := hex.DecodeString(txHex)
+	if err != nil || len(txBytes) == 0 {
+		t.Fatalf("broadcast tx %q", txHex)
+	}
+	tx := txprotocal.ParseTransactionByReader(seria.NewByteBufReader(txBytes, 0))
+	reader := seria.NewByteBufReader(tx.SignData, 0)
+	publicKey, _ := reader.ReadBytesWithLen()
+	signature, _ := reader.ReadBytesWithLen()
+	hash, _ := tx.GetHash().Serialize()
+	verifyKey, err := eckey.FromPubKeyBytes(publicKey)
+	if err != nil || !verifyKey.Verify(hash, signature) || !addressMatchesKey(testAddress, publicKey) {
+		t.Errorf("broadcast tx is not signed by %s", testAddress)
+	}
+}
+
+func TestKeySigner(t *testing.T) {
+	signer, err := NewKeySigner(testAddress, testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.Address() != testAddress || len(signer.PublicKey()) != 33 {
+		t.Errorf("address %s, public key %x", signer.Address(), signer.PublicKey())
+	}
+	if _, err := NewKeySigner("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA", testPrivateKey); err == nil {
+		t.Error("a key of another address was accepted")
+	}
+	if _, err := NewKeySigner(testAddress, "zz"); err == nil {
+		t.Error("an invalid key was accepted")
+	}
+}
+
+func TestMarket_OrderSignerRelease(t *testing.T) {
+	m, _ := NewMarket(WithHost(Beta().Host), WithAddress(testAddress), WithPrivateKey(testPrivateKey))
+	signer, release, err := m.orderSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := signer.Sign(make([]byte, 32)); !errors.Is(err, ErrSignerClosed) {
+		t.Errorf("the key of a released signer was not wiped: %v", err)
+	}
+
+	// a configured signer belongs to the caller and stays usable
+	keySigner, _ := NewKeySigner(testAddress, testPrivateKey)
+	m, _ = NewMarket(WithHost(Beta().Host), WithSigner(keySigner))
+	signer, release, _ = m.orderSigner()
+	release()
+	if _, err := signer.Sign(make([]byte, 32)); err != nil {
+		t.Errorf("the configured signer was closed: %v", err)
+	}
+}
+
+func TestMarket_RemoteSigner(t *testing.T) {
+	keySigner, _ := NewKeySigner(testAddress, testPrivateKey)
+	var authorized bool
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized = r.Header.Get("Authorization") == "Bearer secret"
+		if !authorized {
+			writeSignerError(w, http.StatusUnauthorized, "denied")
+			return
+		}
+		SignerHandler(keySigner).ServeHTTP(w, r)
+	}))
+	defer vault.Close()
+
+	if _, err := NewRemoteSigner(context.Background(), vault.URL, nil); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("expected the denial of the vault, got %v", err)
+	}
+	client := utils.NewClient(nil)
+	client.Header = map[string]string{"Authorization": "Bearer secret"}
+	signer, err := NewRemoteSigner(context.Background(), vault.URL, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var broadcasted string
+	server := newSigningServer(t, &broadcasted, nil)
+	defer server.Close()
+	m, err := NewMarket(WithHost(server.URL), WithSigner(signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Address != testAddress || m.PrivateKey != "" {
+		t.Errorf("address %s, private key %q", m.Address, m.PrivateKey)
+	}
+	order, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, NewDecimalFromInt(1), NewDecimalFromInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Address != testAddress {
+		t.Errorf("order address %s", order.Address)
+	}
+	verifyBroadcastTx(t, broadcasted)
+
+	broadcasted = ""
+	if _, err := m.CancelOrderByAddressCtx(context.Background(), order.Id, testPrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	verifyBroadcastTx(t, broadcasted)
+}
+
+// a signer that signs with a different key than it claims
+type lyingSigner struct {
+	*KeySigner
+	other *KeySigner
+}
+
+func (signer *lyingSigner) Sign(hash []byte) ([]byte, error) {
+	return signer.other.Sign(hash)
+}
+
+func TestMarket_SignerSignatureVerified(t *testing.T) {
+	var broadcasted string
+	server := newSigningServer(t, &broadcasted, nil)
+	defer server.Close()
+
+	honest, _ := NewKeySigner(testAddress, testPrivateKey)
+	other, _ := newKeySigner("", append(make([]byte, 31), 1))
+	m, _ := NewMarket(WithHost(server.URL), WithSigner(&lyingSigner{KeySigner: honest, other: other}))
+	if _, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, NewDecimalFromInt(1), NewDecimalFromInt(1)); err == nil {
+		t.Error("a signature of another key was accepted")
+	}
+	if broadcasted != "" {
+		t.Error("a badly signed tx was broadcast")
+	}
+}
@@ -0,0 +1,359 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/10 上午11:00
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// DefaultSymbolRefresh is how long the symbol list is cached when WithSymbolRefresh is not used
+const DefaultSymbolRefresh = 5 * time.Minute
+
+// an unknown symbol reloads the list at most this often, so a newly listed pair is found without hammering /api/tradings
+const symbolMissRefresh = 10 * time.Second
+
+/**
+ * OrderValidationError reports an order rejected locally before it was signed, errors.Is(err, ErrInvalidOrder) is true
+ * OrderValidationError 表示在签名前被本地校验拒绝的订单，errors.Is(err, ErrInvalidOrder) 为 true
+ */
+type OrderValidationError struct {
+	Symbol	string
+	Field	string
+	Reason	string
+}
+
+func (e *OrderValidationError) Error() string {
+	return fmt.Sprintf("invalid order on %s: %s %s", e.Symbol, e.Field, e.Reason)
+}
+
+func (e *OrderValidationError) Unwrap() error {
+	return ErrInvalidOrder
+}
+
+type symbolCache struct {
+	mu			sync.Mutex
+	symbols		map[string]*Symbol
+	list		[]*Symbol
+	loadedAt	time.Time
+	refresh		time.Duration
+	pairs		map[string]TradingPair	// configured by WithTradingPair, applied to every loaded list
+	loading		*symbolLoad				// the request in flight, shared by concurrent callers
+}
+
+type symbolLoad struct {
+	done	chan struct{}
+	err		error
+}
+
+/**
+ * TradingPair is the on-chain identity of a symbol, /api/tradings does not return it. Orders are only signed or built
+ * once the trading hash and the asset ids of their symbol are known, the tx is checked against them
+ * TradingPair 为交易对在链上的标识，/api/tradings 不返回这些信息。只有已知交易对hash和资产ID时才会签名或组装该交易对的订单，
+ * 交易会根据它们进行校验
+ */
+type TradingPair struct {
+	Symbol				string
+	Hash				string
+	BaseAssetChainId	int
+	BaseAssetId			int
+	QuoteAssetChainId	int
+	QuoteAssetId		int
+}
+
+/**
+ * Declare the trading hash and asset ids of a symbol, they take precedence over whatever the server reports
+ * 声明交易对的hash和资产ID，其优先级高于服务器返回的信息
+ */
+func WithTradingPair(pair TradingPair) Option {
+	return func(config *marketConfig) error {
+		if pair.Symbol == "" {
+			return errors.New("trading pair has no symbol")
+		}
+		probe := &Symbol{Symbol: pair.Symbol}
+		pair.apply(probe)
+		if _, err := probe.tradingHash(); err != nil {
+			return err
+		}
+		cache := &config.market.symbols
+		if cache.pairs == nil {
+			cache.pairs = map[string]TradingPair{}
+		}
+		cache.pairs[pair.Symbol] = pair
+		return nil
+	}
+}
+
+func (pair TradingPair) apply(symbol *Symbol) {
+	symbol.Hash = pair.Hash
+	symbol.BaseAssetChainId, symbol.BaseAssetId = pair.BaseAssetChainId, pair.BaseAssetId
+	symbol.QuoteAssetChainId, symbol.QuoteAssetId = pair.QuoteAssetChainId, pair.QuoteAssetId
+}
+
+// the trading hash, fails unless the hash and the asset ids of both sides are known
+func (symbol *Symbol) tradingHash() ([]byte, error) {
+	hash, err := hex.DecodeString(symbol.Hash)
+	if err != nil || len(hash) != 32 || !validAssetId(symbol.BaseAssetChainId) || !validAssetId(symbol.BaseAssetId) ||
+		!validAssetId(symbol.QuoteAssetChainId) || !validAssetId(symbol.QuoteAssetId) {
+		return nil, fmt.Errorf("symbol %s has no trading hash or asset ids, declare them with WithTradingPair", symbol.Symbol)
+	}
+	return hash, nil
+}
+
+func validAssetId(id int) bool {
+	return id > 0 && id <= math.MaxUint16
+}
+
+/**
+ * Convert a quantity of the base asset to chain units using BaseDecimal, fails if it has too many decimals
+ * 使用 BaseDecimal 将交易资产数量转换为链上最小单位，小数位过多时返回错误
+ */
+func (symbol *Symbol) QuantityUnits(quantity Decimal) (*big.Int, error) {
+	return quantity.BigInt(symbol.BaseDecimal)
+}
+
+/**
+ * Convert a price in the quote asset to chain units using QuoteDecimal, fails if it has too many decimals
+ * 使用 QuoteDecimal 将计价资产价格转换为链上最小单位，小数位过多时返回错误
+ */
+func (symbol *Symbol) PriceUnits(price Decimal) (*big.Int, error) {
+	return price.BigInt(symbol.QuoteDecimal)
+}
+
+func (symbol *Symbol) QuantityFromUnits(units *big.Int) Decimal {
+	return NewDecimalFromBigInt(units, symbol.BaseDecimal)
+}
+
+func (symbol *Symbol) PriceFromUnits(units *big.Int) Decimal {
+	return NewDecimalFromBigInt(units, symbol.QuoteDecimal)
+}
+
+/**
+ * The smallest legal step of a price, 10^-QuoteDecimal
+ * 价格的最小变动单位，10^-QuoteDecimal
+ */
+func (symbol *Symbol) PriceTick() Decimal {
+	return NewDecimal(1, int32(symbol.QuoteDecimal))
+}
+
+/**
+ * The smallest legal step of a quantity, 10^-BaseDecimal
+ * 数量的最小变动单位，10^-BaseDecimal
+ */
+func (symbol *Symbol) QuantityTick() Decimal {
+	return NewDecimal(1, int32(symbol.BaseDecimal))
+}
+
+/**
+ * Round the price half-up to the price tick
+ * 将价格四舍五入到最小价格单位
+ */
+func (symbol *Symbol) RoundPrice(price Decimal) Decimal {
+	return price.Round(int32(symbol.QuoteDecimal))
+}
+
+/**
+ * Round the quantity down to the quantity tick, so the rounded order never exceeds the amount the caller asked for
+ * 将数量向下取整到最小数量单位，保证取整后的数量不会超过调用方指定的数量
+ */
+func (symbol *Symbol) RoundQuantity(quantity Decimal) Decimal {
+	return quantity.Truncate(int32(symbol.BaseDecimal))
+}
+
+/**
+ * Check price and quantity against the trading pair: both positive, quantity not below the minimum and both fitting the decimals
+ * 根据交易对校验价格和数量：均为正数，数量不低于最小委托数量，且小数位数不超过精度
+ */
+func (symbol *Symbol) ValidateOrder(price, quantity Decimal) error {
+	invalid := func(field, reason string) error {
+		return &OrderValidationError{Symbol: symbol.Symbol, Field: field, Reason: reason}
+	}
+	if price.Sign() <= 0 {
+		return invalid("price", "must be positive")
+	}
+	if quantity.Sign() <= 0 {
+		return invalid("quantity", "must be positive")
+	}
+	if p := price.Precision(); p > int32(symbol.QuoteDecimal) {
+		return invalid("price", fmt.Sprintf("%s has %d decimals, at most %d allowed", price, p, symbol.QuoteDecimal))
+	}
+	if p := quantity.Precision(); p > int32(symbol.BaseDecimal) {
+		return invalid("quantity", fmt.Sprintf("%s has %d decimals, at most %d allowed", quantity, p, symbol.BaseDecimal))
+	}
+	if quantity.LessThan(symbol.BaseMinTradingAmount) {
+		return invalid("quantity", fmt.Sprintf("%s is below the minimum trading amount %s", quantity, symbol.BaseMinTradingAmount))
+	}
+	return nil
+}
+
+/**
+ * Set how long the symbol list is cached before it is loaded again, the list is loaded lazily on first use
+ * 设置交易对列表的缓存时间，到期后重新加载，列表在首次使用时加载
+ */
+func WithSymbolRefresh(interval time.Duration) Option {
+	return func(config *marketConfig) error {
+		if interval <= 0 {
+			return fmt.Errorf("symbol refresh interval must be positive")
+		}
+		config.market.symbols.refresh = interval
+		return nil
+	}
+}
+
+/**
+ * Get a copy of a trading pair from the cached symbol list, fails with ErrSymbolUnknown if the server does not list it
+ * 从缓存的交易对列表中获取交易对的副本，服务器不存在该交易对时返回 ErrSymbolUnknown
+ */
+func (market *Market) Symbol(ctx context.Context, name string) (*Symbol, error) {
+	if err := market.loadSymbols(ctx, false); err != nil {
+		return nil, err
+	}
+	symbol, loadedAt := market.cachedSymbol(name)
+	if symbol != nil {
+		return symbol, nil
+	}
+	if time.Since(loadedAt) >= symbolMissRefresh {
+		if err := market.loadSymbols(ctx, true); err != nil {
+			return nil, err
+		}
+		if symbol, _ = market.cachedSymbol(name); symbol != nil {
+			return symbol, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSymbolUnknown, name)
+}
+
+// a copy of the cached symbol, so callers can not change what orders are validated against
+func (market *Market) cachedSymbol(name string) (*Symbol, time.Time) {
+	cache := &market.symbols
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if symbol, ok := cache.symbols[name]; ok {
+		copied := *symbol
+		return &copied, cache.loadedAt
+	}
+	return nil, cache.loadedAt
+}
+
+/**
+ * Get copies of all trading pairs from the cached symbol list
+ * 从缓存的交易对列表中获取所有交易对的副本
+ */
+func (market *Market) Symbols(ctx context.Context) ([]*Symbol, error) {
+	if err := market.loadSymbols(ctx, false); err != nil {
+		return nil, err
+	}
+	cache := &market.symbols
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	list := make([]*Symbol, len(cache.list))
+	for i, symbol := range cache.list {
+		copied := *symbol
+		list[i] = &copied
+	}
+	return list, nil
+}
+
+/**
+ * Reload the symbol list now
+ * 立即重新加载交易对列表
+ */
+func (market *Market) RefreshSymbols(ctx context.Context) error {
+	return market.loadSymbols(ctx, true)
+}
+
+// load the list unless the cached one is fresh. Concurrent callers share one request, which runs without holding
+// symbols.mu so cached symbols stay available meanwhile; a failed reload keeps serving the previous list
+func (market *Market) loadSymbols(ctx context.Context, force bool) error {
+	cache := &market.symbols
+	cache.mu.Lock()
+	refresh := cache.refresh
+	if refresh == 0 {
+		refresh = DefaultSymbolRefresh
+	}
+	if !force && cache.symbols != nil && time.Since(cache.loadedAt) < refresh {
+		cache.mu.Unlock()
+		return nil
+	}
+	load := cache.loading
+	leader := load == nil
+	if leader {
+		load = &symbolLoad{done: make(chan struct{})}
+		cache.loading = load
+	}
+	cache.mu.Unlock()
+
+	if leader {
+		list, err := market.GetSymbolsCtx(ctx)
+		cache.mu.Lock()
+		if err == nil {
+			cache.publish(list)
+		}
+		load.err = err
+		cache.loading = nil
+		cache.mu.Unlock()
+		close(load.done)
+	} else {
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if load.err != nil {
+		cache.mu.Lock()
+		stale := cache.symbols != nil
+		cache.mu.Unlock()
+		if stale && !force {
+			return nil
+		}
+		return load.err
+	}
+	return nil
+}
+
+// callers hold mu
+func (cache *symbolCache) publish(list []*Symbol) {
+	symbols := make(map[string]*Symbol, len(list))
+	for _, symbol := range list {
+		if pair, ok := cache.pairs[symbol.Symbol]; ok {
+			pair.apply(symbol)
+		}
+		symbols[symbol.Symbol] = symbol
+	}
+	cache.symbols = symbols
+	cache.list = list
+	cache.loadedAt = time.Now()
+}
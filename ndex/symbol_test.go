@@ -0,0 +1,188 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/4 下午4:10
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serveTestdata(t *testing.T, w http.ResponseWriter, name string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	w.Write(data)
+}
+
+func TestSymbol_ValidateOrder(t *testing.T) {
+	symbol := &Symbol{Symbol: "NVTUSDT", BaseDecimal: 8, QuoteDecimal: 6, BaseMinTradingAmount: NewDecimalFromInt(10)}
+	cases := []struct {
+		price, quantity string
+		field           string
+	}{
+		{"0.0446", "10", ""},
+		{"0.044600", "10.00000001", ""},
+		{"0", "10", "price"},
+		{"0.0446", "-1", "quantity"},
+		{"0.0000001", "10", "price"},
+		{"0.0446", "10.000000001", "quantity"},
+		{"0.0446", "9.99999999", "quantity"},
+	}
+	for _, c := range cases {
+		err := symbol.ValidateOrder(MustParseDecimal(c.price), MustParseDecimal(c.quantity))
+		if c.field == "" {
+			if err != nil {
+				t.Errorf("%s @ %s: %v", c.quantity, c.price, err)
+			}
+			continue
+		}
+		var validationError *OrderValidationError
+		if !errors.As(err, &validationError) || validationError.Field != c.field || !errors.Is(err, ErrInvalidOrder) {
+			t.Errorf("%s @ %s: expected %s error, got %v", c.quantity, c.price, c.field, err)
+		}
+	}
+	if got := symbol.RoundPrice(MustParseDecimal("0.04460051")); got.String() != "0.044601" {
+		t.Errorf("rounded price %s", got)
+	}
+	if got := symbol.RoundQuantity(MustParseDecimal("10.123456789")); got.String() != "10.12345678" {
+		t.Errorf("rounded quantity %s", got)
+	}
+	if symbol.PriceTick().String() != "0.000001" || symbol.QuantityTick().String() != "0.00000001" {
+		t.Errorf("ticks %s %s", symbol.PriceTick(), symbol.QuantityTick())
+	}
+}
+
+func TestMarket_SymbolCache(t *testing.T) {
+	var loads, orders int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tradings":
+			atomic.AddInt32(&loads, 1)
+			serveTestdata(t, w, "tradings.json")
+		default:
+			atomic.AddInt32(&orders, 1)
+			w.Write([]byte(`{"code":1,"success":false,"msg":"stop here"}`))
+		}
+	}))
+	defer server.Close()
+
+	m, err := NewMarket(WithHost(server.URL), WithSymbolRefresh(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if symbol, err := m.Symbol(ctx, "NVTUSDT"); err != nil || symbol.QuoteDecimal != 6 {
+			t.Fatalf("symbol %v, %v", symbol, err)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("symbol list loaded %d times, want 1", n)
+	}
+	if _, err := m.Symbol(ctx, "BTCUSDT"); !errors.Is(err, ErrSymbolUnknown) {
+		t.Errorf("expected ErrSymbolUnknown, got %v", err)
+	}
+
+	address, key := "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD", "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df"
+	if _, err := m.NewOrderByAddressCtx(ctx, address, key, "BTCUSDT", SideBuy, NewDecimalFromInt(1), NewDecimalFromInt(1)); !errors.Is(err, ErrSymbolUnknown) {
+		t.Errorf("expected ErrSymbolUnknown, got %v", err)
+	}
+	if _, err := m.NewOrderByAddressCtx(ctx, address, key, "NVTUSDT", SideBuy, MustParseDecimal("0.0446"), MustParseDecimal("5")); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected ErrInvalidOrder, got %v", err)
+	}
+	if n := atomic.LoadInt32(&orders); n != 0 {
+		t.Errorf("%d invalid orders reached the server", n)
+	}
+	if err := m.RefreshSymbols(ctx); err != nil || atomic.LoadInt32(&loads) != 2 {
+		t.Errorf("refresh: %v, %d loads", err, atomic.LoadInt32(&loads))
+	}
+}
+
+func TestMarket_SymbolCacheSlowLoad(t *testing.T) {
+	var requests int32
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first load answers at once, the following ones hang until released
+		if atomic.AddInt32(&requests, 1) > 1 {
+			<-hang
+		}
+		serveTestdata(t, w, "tradings.json")
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	m, _ := NewMarket(WithHost(server.URL))
+	ctx := context.Background()
+	symbol, err := m.Symbol(ctx, "NVTNULS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// callers get copies
+	symbol.BaseDecimal = 0
+	if again, _ := m.Symbol(ctx, "NVTNULS"); again.BaseDecimal != 8 {
+		t.Error("a returned symbol changed the cache")
+	}
+	list, _ := m.Symbols(ctx)
+	list[0].QuoteDecimal = 0
+	if again, _ := m.Symbols(ctx); again[0].QuoteDecimal == 0 {
+		t.Error("a symbol of the list changed the cache")
+	}
+
+	// a hanging reload does not block cached symbols, concurrent reloads share the request
+	for i := 0; i < 2; i++ {
+		go m.RefreshSymbols(ctx)
+	}
+	waitFor(t, "the reload", func() bool { return atomic.LoadInt32(&requests) == 2 })
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Symbol(ctx, "NVTUSDT")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a cached symbol waited for the reload")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("%d requests, concurrent reloads were not shared", n)
+	}
+}
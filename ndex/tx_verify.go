@@ -0,0 +1,262 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/8 下午3:00
+ */
+package ndex
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+/**
+ * TxIntent is what the caller asked for, the server-built tx is checked against it before it is signed
+ * TxIntent 为调用方的请求内容，签名前会用它校验服务端组装的交易
+ */
+type TxIntent struct {
+	TxType		uint16
+	Address		string		// the signing address, empty when a cancel is signed with a bare private key
+	PublicKey	[]byte		// public key of the signer
+	Symbol		*Symbol		// orders only
+	Side		Side		// orders only
+	Price		Decimal		// orders only
+	Quantity	Decimal		// orders only
+	OrderId		string		// cancels only
+	FeeAddress	string		// orders only, the broker fee address; empty expects the signing address
+	FeeScale	byte		// orders only
+}
+
+/**
+ * TxPolicy is an extra check run after the built-in ones, a non-nil error rejects the tx
+ * TxPolicy 为内置校验之后的额外检查，返回非 nil 的错误将拒绝该交易
+ */
+type TxPolicy func(intent *TxIntent, tx *DecodedTx) error
+
+/**
+ * TxVerificationError reports a server-built tx that does not match the request, errors.Is(err, ErrTxMismatch) is true
+ * TxVerificationError 表示服务端组装的交易与请求不符，errors.Is(err, ErrTxMismatch) 为 true
+ */
+type TxVerificationError struct {
+	TxHash		string
+	Field		string
+	Expected	string
+	Actual		string
+	Err			error	// the error of a failed TxPolicy or of decoding
+}
+
+func (e *TxVerificationError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("refusing to sign tx %s: %s: %v", e.TxHash, e.Field, e.Err)
+	}
+	return fmt.Sprintf("refusing to sign tx %s: %s is %s, expected %s", e.TxHash, e.Field, e.Actual, e.Expected)
+}
+
+func (e *TxVerificationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TxVerificationError) Is(target error) bool {
+	return target == ErrTxMismatch
+}
+
+/**
+ * Run policy on every order and cancel tx after the built-in checks, several policies run in the order they were added
+ * 在内置校验之后对每笔下单和撤单交易执行 policy，多个 policy 按添加顺序执行
+ */
+func WithTxPolicy(policy TxPolicy) Option {
+	return func(config *marketConfig) error {
+		if policy == nil {
+			return errors.New("tx policy can not be nil")
+		}
+		config.market.txPolicies = append(config.market.txPolicies, policy)
+		return nil
+	}
+}
+
+/**
+ * Decode the server-built tx and check type, trading pair, locked asset and amount, fee and addresses against intent, then run the configured policies
+ * 解析服务端组装的交易，根据 intent 校验交易类型、交易对、锁定的资产及数量、手续费和地址，然后执行已配置的 policy
+ */
+func (market *Market) verifyTx(txHex string, intent *TxIntent) (*DecodedTx, error) {
+	decoded, err := DecodeTx(txHex)
+	if err != nil {
+		return nil, &TxVerificationError{Field: "encoding", Err: err}
+	}
+	if err := checkTx(intent, decoded); err != nil {
+		return nil, err
+	}
+	for _, policy := range market.txPolicies {
+		if err := policy(intent, decoded); err != nil {
+			return nil, &TxVerificationError{TxHash: decoded.Tx.GetHash().String(), Field: "policy", Err: err}
+		}
+	}
+	return decoded, nil
+}
+
+func checkTx(intent *TxIntent, decoded *DecodedTx) error {
+	tx := decoded.Tx
+	mismatch := func(field string, expected, actual interface{}) error {
+		return &TxVerificationError{
+			TxHash: tx.GetHash().String(),
+			Field: field,
+			Expected: fmt.Sprint(expected),
+			Actual: fmt.Sprint(actual),
+		}
+	}
+	if tx.TxType != intent.TxType {
+		return mismatch("tx type", intent.TxType, tx.TxType)
+	}
+	owner, err := intentOwner(intent)
+	if err != nil {
+		return &TxVerificationError{TxHash: tx.GetHash().String(), Field: "address", Err: err}
+	}
+	// funds may only move between our own balances, the order locks them and the cancel unlocks them
+	for i, from := range decoded.CoinData.Froms {
+		if !owner(from.Address) {
+			return mismatch(fmt.Sprintf("coin from[%d] address", i), intent.Address, formatAddress(from.Address))
+		}
+	}
+	for i, to := range decoded.CoinData.Tos {
+		if !owner(to.Address) {
+			return mismatch(fmt.Sprintf("coin to[%d] address", i), intent.Address, formatAddress(to.Address))
+		}
+	}
+
+	switch tx.TxType {
+	case TxTypeTradingOrder:
+		order := decoded.Order
+		if !owner(order.Address) {
+			return mismatch("order address", intent.Address, formatAddress(order.Address))
+		}
+		if order.Type != intent.Side {
+			return mismatch("order side", intent.Side, order.Type)
+		}
+		quantity, err := intent.Symbol.QuantityUnits(intent.Quantity)
+		if err != nil {
+			return &TxVerificationError{TxHash: tx.GetHash().String(), Field: "order quantity", Err: err}
+		}
+		if order.Amount.Cmp(quantity) != 0 {
+			return mismatch("order quantity", intent.Quantity, intent.Symbol.QuantityFromUnits(order.Amount))
+		}
+		price, err := intent.Symbol.PriceUnits(intent.Price)
+		if err != nil {
+			return &TxVerificationError{TxHash: tx.GetHash().String(), Field: "order price", Err: err}
+		}
+		if order.Price.Cmp(price) != 0 {
+			return mismatch("order price", intent.Price, intent.Symbol.PriceFromUnits(order.Price))
+		}
+		if err := checkOrderSymbol(intent, decoded, quantity, price, mismatch); err != nil {
+			return err
+		}
+		if err := checkOrderFee(intent, order, owner, mismatch); err != nil {
+			return err
+		}
+	case TxTypeTradingOrderCancel:
+		orderHash := hex.EncodeToString(decoded.Cancel.OrderHash)
+		if orderHash != strings.ToLower(intent.OrderId) {
+			return mismatch("cancelled order", intent.OrderId, orderHash)
+		}
+	}
+	return nil
+}
+
+/**
+ * The order must trade intent.Symbol and lock exactly what the order needs, a buy the quote amount and a sell the
+ * quantity. A symbol without trading hash and asset ids is rejected, the pair and the asset could not be checked
+ * 订单必须属于 intent.Symbol，且只锁定订单所需的资产：买单锁定计价资产，卖单锁定交易资产。缺少交易对hash或资产ID的交易对会被拒绝，
+ * 否则无法校验交易对和资产
+ */
+func checkOrderSymbol(intent *TxIntent, decoded *DecodedTx, quantity, price *big.Int, mismatch func(string, interface{}, interface{}) error) error {
+	symbol := intent.Symbol
+	expectedHash, err := symbol.tradingHash()
+	if err != nil {
+		return &TxVerificationError{TxHash: decoded.Tx.GetHash().String(), Field: "trading pair", Err: err}
+	}
+	if !bytes.Equal(decoded.Order.TradingHash, expectedHash) {
+		return mismatch("trading pair", symbol.Hash, hex.EncodeToString(decoded.Order.TradingHash))
+	}
+	froms, tos := decoded.CoinData.Froms, decoded.CoinData.Tos
+	if len(froms) != 1 || len(tos) != 1 {
+		return mismatch("coin count", "1 from and 1 to", fmt.Sprintf("%d from and %d to", len(froms), len(tos)))
+	}
+	from, to := froms[0], tos[0]
+	chainId, assetId, amount := lockedAsset(symbol, intent.Side, quantity, price)
+	if from.AssetsChainId != chainId || from.AssetsId != assetId {
+		return mismatch("coin from[0] asset", fmt.Sprintf("%d-%d", chainId, assetId), fmt.Sprintf("%d-%d", from.AssetsChainId, from.AssetsId))
+	}
+	if to.AssetsChainId != from.AssetsChainId || to.AssetsId != from.AssetsId {
+		return mismatch("coin to[0] asset", fmt.Sprintf("%d-%d", from.AssetsChainId, from.AssetsId), fmt.Sprintf("%d-%d", to.AssetsChainId, to.AssetsId))
+	}
+	if from.Amount == nil || from.Amount.Cmp(amount) != 0 {
+		return mismatch("coin from[0] amount", amount, from.Amount)
+	}
+	if to.Amount == nil || to.Amount.Cmp(amount) != 0 {
+		return mismatch("coin to[0] amount", amount, to.Amount)
+	}
+	if to.LockValue != lockedByOrder {
+		return mismatch("coin to[0] lock", uint64(lockedByOrder), to.LockValue)
+	}
+	return nil
+}
+
+// the fee goes to the configured broker, or back to the signer when there is none
+func checkOrderFee(intent *TxIntent, order *TradingOrderData, owner func([]byte) bool, mismatch func(string, interface{}, interface{}) error) error {
+	if intent.FeeAddress == "" {
+		if !owner(order.FeeAddress) {
+			return mismatch("fee address", intent.Address, formatAddress(order.FeeAddress))
+		}
+	} else if expected, err := addressBytes(intent.FeeAddress); err != nil || !bytes.Equal(order.FeeAddress, expected) {
+		return mismatch("fee address", intent.FeeAddress, formatAddress(order.FeeAddress))
+	}
+	if order.FeeScale != intent.FeeScale {
+		return mismatch("fee scale", intent.FeeScale, order.FeeScale)
+	}
+	return nil
+}
+
+// match raw address bytes against the signing address, or against the public key when no address is known
+func intentOwner(intent *TxIntent) (func([]byte) bool, error) {
+	if intent.Address != "" {
+		expected, err := addressBytes(intent.Address)
+		if err != nil {
+			return nil, err
+		}
+		return func(raw []byte) bool {
+			return bytes.Equal(raw, expected)
+		}, nil
+	}
+	if len(intent.PublicKey) == 0 {
+		return nil, errors.New("neither address nor public key of the signer is known")
+	}
+	return func(raw []byte) bool {
+		return len(raw) == 23 && addressMatchesKey(formatAddress(raw), intent.PublicKey)
+	}, nil
+}
@@ -0,0 +1,254 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/8 下午5:10
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/niels1286/nuls-go-sdk/account"
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+)
+
+// the symbols of testdata/synthetic_tradings.json, NVTNULS carries a trading hash and asset ids
+func testSymbols() map[string]*Symbol {
+	payload, _ := ioutil.ReadFile(filepath.Join("testdata", "synthetic_tradings.json"))
+	response := &GetSymbols{}
+	json.Unmarshal(payload, response)
+	symbols := map[string]*Symbol{}
+	for _, symbol := range response.Data {
+		symbols[symbol.Symbol] = symbol
+	}
+	return symbols
+}
+
+// build the tx a well behaved server returns for the request, symbols are those of testSymbols
+func buildTestTx(path string, params map[string]interface{}) *DecodedTx {
+	tx := &txprotocal.Transaction{Time: 1591344000, Remark: []byte{}}
+	decoded := &DecodedTx{Tx: tx, CoinData: &txprotocal.CoinData{}}
+	if path == "/api/cancelOrder" {
+		orderHash, _ := hex.DecodeString(params["orderId"].(string))
+		tx.TxType = TxTypeTradingOrderCancel
+		decoded.Cancel = &CancelOrderData{OrderHash: orderHash}
+		return decoded
+	}
+	address := account.AddressStrToBytes(params["address"].(string))
+	symbol := testSymbols()[params["symbol"].(string)]
+	side, _ := params["type"].(json.Number).Int64()
+	quantity, _ := symbol.QuantityUnits(MustParseDecimal(params["quantity"].(json.Number).String()))
+	price, _ := symbol.PriceUnits(MustParseDecimal(params["price"].(json.Number).String()))
+	tradingHash, _ := hex.DecodeString(symbol.Hash)
+	if tradingHash == nil {
+		tradingHash = make([]byte, 32)
+	}
+	tx.TxType = TxTypeTradingOrder
+	decoded.Order = &TradingOrderData{
+		TradingHash: tradingHash,
+		Address:     address,
+		Type:        Side(side),
+		Amount:      quantity,
+		Price:       price,
+		FeeAddress:  address,
+		FeeScale:    0,
+	}
+	chainId, assetId, amount := lockedAsset(symbol, Side(side), quantity, price)
+	coin := txprotocal.Coin{Address: address, AssetsChainId: chainId, AssetsId: assetId, Amount: amount}
+	decoded.CoinData.Froms = []txprotocal.CoinFrom{{Coin: coin, Nonce: make([]byte, 8)}}
+	decoded.CoinData.Tos = []txprotocal.CoinTo{{Coin: coin, LockValue: math.MaxUint64}}
+	return decoded
+}
+
+// the trading hash and asset ids of NVTNULS in testSymbols, declared for markets serving testdata/tradings.json
+func testTradingPair() TradingPair {
+	symbol := testSymbols()["NVTNULS"]
+	return TradingPair{
+		Symbol: symbol.Symbol,
+		Hash: symbol.Hash,
+		BaseAssetChainId: symbol.BaseAssetChainId,
+		BaseAssetId: symbol.BaseAssetId,
+		QuoteAssetChainId: symbol.QuoteAssetChainId,
+		QuoteAssetId: symbol.QuoteAssetId,
+	}
+}
+
+func encodeTestTx(decoded *DecodedTx) string {
+	tx := decoded.Tx
+	if decoded.Order != nil {
+		tx.Extend = decoded.Order.Serialize()
+	}
+	if decoded.Cancel != nil {
+		tx.Extend = decoded.Cancel.Serialize()
+	}
+	if len(decoded.CoinData.Froms) + len(decoded.CoinData.Tos) > 0 {
+		tx.CoinData, _ = decoded.CoinData.Serialize()
+	}
+	txBytes, _ := tx.Serialize()
+	return hex.EncodeToString(txBytes)
+}
+
+func TestDecodeTx(t *testing.T) {
+	decoded := buildTestTx("/api/order", map[string]interface{}{
+		"address": testAddress, "symbol": "NVTNULS", "type": json.Number("2"),
+		"quantity": json.Number("12.5"), "price": json.Number("0.3"),
+	})
+	txHex := encodeTestTx(decoded)
+	got, err := DecodeTx(txHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Order.Type != SideSell || got.Order.Amount.String() != "1250000000" || got.Order.Price.String() != "30000000" {
+		t.Errorf("decoded order %+v", got.Order)
+	}
+	if len(got.CoinData.Froms) != 1 || len(got.CoinData.Tos) != 1 {
+		t.Errorf("decoded coin data %+v", got.CoinData)
+	}
+	for _, bad := range []string{txHex[:len(txHex)-2], txHex + "00", "e500f4bdb95e0000", "zz"} {
+		if _, err := DecodeTx(bad); err == nil {
+			t.Errorf("malformed tx %s was accepted", bad)
+		}
+	}
+}
+
+func TestMarket_RejectsTamperedTx(t *testing.T) {
+	thief := account.AddressStrToBytes("TNVTdTSPRnXkDiagy7enti1KL75NU5AxC9sQA")
+	cases := map[string]func(*DecodedTx){
+		"tx type": func(d *DecodedTx) { d.Tx.TxType = txprotocal.TX_TYPE_TRANSFER },
+		"coin to[0] address": func(d *DecodedTx) { d.CoinData.Tos[0].Address = thief },
+		"coin from[0] address": func(d *DecodedTx) { d.CoinData.Froms[0].Address = thief },
+		"order address": func(d *DecodedTx) { d.Order.Address = thief },
+		"order side": func(d *DecodedTx) { d.Order.Type = SideSell },
+		"order quantity": func(d *DecodedTx) { d.Order.Amount = new(big.Int).Mul(d.Order.Amount, big.NewInt(10)) },
+		"order price": func(d *DecodedTx) { d.Order.Price = big.NewInt(1) },
+		"trading pair": func(d *DecodedTx) { d.Order.TradingHash = make([]byte, 32) },
+		"coin from[0] asset": func(d *DecodedTx) {
+			// the base asset instead of the quote asset a buy has to lock
+			d.CoinData.Froms[0].AssetsChainId, d.CoinData.Tos[0].AssetsChainId = 5, 5
+		},
+		"coin to[0] asset": func(d *DecodedTx) { d.CoinData.Tos[0].AssetsId = 7 },
+		"coin from[0] amount": func(d *DecodedTx) {
+			d.CoinData.Froms[0].Amount = new(big.Int).Mul(d.CoinData.Froms[0].Amount, big.NewInt(2))
+		},
+		"coin to[0] lock": func(d *DecodedTx) { d.CoinData.Tos[0].LockValue = 0 },
+		"coin count": func(d *DecodedTx) { d.CoinData.Tos = append(d.CoinData.Tos, d.CoinData.Tos[0]) },
+		"fee address": func(d *DecodedTx) { d.Order.FeeAddress = thief },
+		"fee scale": func(d *DecodedTx) { d.Order.FeeScale = 100 },
+		"encoding": func(d *DecodedTx) { d.Order, d.Cancel = nil, &CancelOrderData{OrderHash: make([]byte, 32)} },
+	}
+	for field, tamper := range cases {
+		var broadcasted string
+		server := newSigningServer(t, &broadcasted, tamper)
+		m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey))
+		_, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5"))
+		var verificationError *TxVerificationError
+		if !errors.As(err, &verificationError) || verificationError.Field != field || !errors.Is(err, ErrTxMismatch) {
+			t.Errorf("%s: got %v", field, err)
+		}
+		if broadcasted != "" {
+			t.Errorf("%s: tampered tx was broadcast", field)
+		}
+		server.Close()
+	}
+}
+
+func TestMarket_TamperedTxOfRecordedSymbol(t *testing.T) {
+	// testdata/tradings.json, as served by the real gateway, carries no trading hash and no asset ids
+	pair := testTradingPair()
+	cases := []struct {
+		name	string
+		pair	bool
+		tamper	func(*DecodedTx)
+		field	string
+	}{
+		{"undeclared pair", false, nil, "trading pair"},
+		{"undeclared pair with another hash", false, func(d *DecodedTx) { d.Order.TradingHash = make([]byte, 32) }, "trading pair"},
+		{"another pair", true, func(d *DecodedTx) { d.Order.TradingHash = make([]byte, 32) }, "trading pair"},
+		{"another asset", true, func(d *DecodedTx) {
+			d.CoinData.Froms[0].AssetsChainId, d.CoinData.Tos[0].AssetsChainId = 5, 5
+		}, "coin from[0] asset"},
+		{"declared pair", true, nil, ""},
+	}
+	for _, c := range cases {
+		var broadcasted string
+		server := newSigningServerWith(t, "tradings.json", &broadcasted, c.tamper)
+		opts := []Option{WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey)}
+		if c.pair {
+			opts = append(opts, WithTradingPair(pair))
+		}
+		m, err := NewMarket(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5"))
+		var verificationError *TxVerificationError
+		if c.field == "" {
+			if err != nil || broadcasted == "" {
+				t.Errorf("%s: %v", c.name, err)
+			}
+		} else if !errors.As(err, &verificationError) || verificationError.Field != c.field || broadcasted != "" {
+			t.Errorf("%s: got %v", c.name, err)
+		}
+		server.Close()
+	}
+
+	if _, err := NewMarket(WithTradingPair(TradingPair{Symbol: "NVTNULS", Hash: pair.Hash})); err == nil {
+		t.Error("a trading pair without asset ids was accepted")
+	}
+}
+
+func TestMarket_TxPolicy(t *testing.T) {
+	var broadcasted string
+	server := newSigningServer(t, &broadcasted, nil)
+	defer server.Close()
+
+	// the fee is checked by the built-in checks, a policy adds limits of its own
+	errTooLarge := errors.New("order too large")
+	m, _ := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey),
+		WithTxPolicy(func(intent *TxIntent, tx *DecodedTx) error {
+			if tx.Order != nil && intent.Quantity.GreaterThan(NewDecimalFromInt(10)) {
+				return errTooLarge
+			}
+			return nil
+		}))
+	_, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5"))
+	if !errors.Is(err, errTooLarge) || !errors.Is(err, ErrTxMismatch) {
+		t.Errorf("expected the policy error, got %v", err)
+	}
+	orderId := "82ad1756b22f480195c3f7eee5dfe2cf43e661b404f828255903cedb70172e40"
+	if _, err := m.CancelOrderCtx(context.Background(), orderId); err != nil {
+		t.Errorf("cancel: %v", err)
+	}
+	verifyBroadcastTx(t, broadcasted)
+}
@@ -0,0 +1,394 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/9 上午10:40
+ */
+package ndex
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+)
+
+// funds locked by an order stay locked until the order is filled or cancelled
+const lockedByOrder = math.MaxUint64
+
+/**
+ * Parameters of a locally built order tx
+ * 本地组装挂单交易的参数
+ */
+type OrderTxParams struct {
+	Symbol		*Symbol		// needs Hash and the asset chain ids and asset ids
+	Address		string
+	Side		Side
+	Price		Decimal
+	Quantity	Decimal
+	Nonce		[]byte		// 8 byte nonce of the locked asset, the quote asset for a buy and the base asset for a sell
+	Time		time.Time
+	FeeAddress	string		// broker fee address, defaults to Address
+	FeeScale	byte		// broker fee scale
+}
+
+/**
+ * Build an unsigned TRADING_ORDER tx. A buy locks price * quantity of the quote asset (rounded down to the quote
+ * decimals), a sell locks quantity of the base asset; the locked coin goes back to the same address with a permanent lock.
+ * 组装未签名的挂单交易。买单锁定 price * quantity 的计价资产（按计价资产精度向下取整），卖单锁定 quantity 的交易资产。
+ */
+func BuildOrderTx(params *OrderTxParams) (*txprotocal.Transaction, error) {
+	symbol := params.Symbol
+	if symbol == nil {
+		return nil, errors.New("symbol can not be nil")
+	}
+	if !params.Side.Valid() {
+		return nil, fmt.Errorf("invalid order side %d", int(params.Side))
+	}
+	if err := symbol.ValidateOrder(params.Price, params.Quantity); err != nil {
+		return nil, err
+	}
+	tradingHash, err := symbol.tradingHash()
+	if err != nil {
+		return nil, err
+	}
+	address, err := addressBytes(params.Address)
+	if err != nil {
+		return nil, err
+	}
+	feeAddress := address
+	if params.FeeAddress != "" {
+		if feeAddress, err = addressBytes(params.FeeAddress); err != nil {
+			return nil, fmt.Errorf("fee address: %w", err)
+		}
+	}
+	if len(params.Nonce) != 8 {
+		return nil, fmt.Errorf("nonce must be 8 bytes, got %d", len(params.Nonce))
+	}
+	amount, err := symbol.QuantityUnits(params.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	price, err := symbol.PriceUnits(params.Price)
+	if err != nil {
+		return nil, err
+	}
+	orderData := &TradingOrderData{
+		TradingHash: tradingHash,
+		Address: address,
+		Type: params.Side,
+		Amount: amount,
+		Price: price,
+		FeeAddress: feeAddress,
+		FeeScale: params.FeeScale,
+	}
+	lockChainId, lockAssetId, lockAmount := lockedAsset(symbol, params.Side, amount, price)
+	coin := txprotocal.Coin{
+		Address: address,
+		AssetsChainId: lockChainId,
+		AssetsId: lockAssetId,
+		Amount: lockAmount,
+	}
+	coinData := &txprotocal.CoinData{
+		Froms: []txprotocal.CoinFrom{{Coin: coin, Nonce: params.Nonce, Locked: 0}},
+		Tos: []txprotocal.CoinTo{{Coin: coin, LockValue: lockedByOrder}},
+	}
+	coinDataBytes, err := coinData.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return &txprotocal.Transaction{
+		TxType: TxTypeTradingOrder,
+		Time: txTime(params.Time),
+		Remark: []byte{},
+		Extend: orderData.Serialize(),
+		CoinData: coinDataBytes,
+	}, nil
+}
+
+/**
+ * The nonce an account uses after the given tx, the last 8 bytes of its hash
+ * 账户在该交易之后使用的 nonce，即交易hash的最后 8 个字节
+ */
+func NonceFromTxHash(txHash string) ([]byte, error) {
+	hash, err := hex.DecodeString(txHash)
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("invalid tx hash %s", txHash)
+	}
+	return hash[24:], nil
+}
+
+func lockedAsset(symbol *Symbol, side Side, amount, price *big.Int) (uint16, uint16, *big.Int) {
+	if side == SideSell {
+		return uint16(symbol.BaseAssetChainId), uint16(symbol.BaseAssetId), amount
+	}
+	quote := new(big.Int).Mul(amount, price)
+	quote.Quo(quote, pow10(int32(symbol.BaseDecimal)))
+	return uint16(symbol.QuoteAssetChainId), uint16(symbol.QuoteAssetId), quote
+}
+
+func txTime(t time.Time) uint32 {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return uint32(t.Unix())
+}
+
+/**
+ * Build order transactions locally instead of asking /api/order, cancels are still built by /api/cancelOrder.
+ * Nonces are taken from the ledger once per asset and then chained from the hashes of our own transactions; a failed
+ * broadcast drops the cached nonce, so orders built on top of it fail and the ledger is asked again. /api/tradings
+ * does not return the trading hash and asset ids, only pairs declared with WithTradingPair can be traded and
+ * NewMarket fails when none is declared.
+ * 在本地组装下单交易，不再请求 /api/order，撤单交易仍由 /api/cancelOrder 组装。每种资产的 nonce 只从账本获取一次，之后由本地交易的hash
+ * 推算；广播失败时丢弃缓存的 nonce，基于它组装的订单会失败，之后重新从账本获取。/api/tradings 不返回交易对hash和资产ID，
+ * 只能交易通过 WithTradingPair 声明的交易对，未声明任何交易对时 NewMarket 返回错误。
+ */
+func WithLocalTxBuilding() Option {
+	return func(config *marketConfig) error {
+		config.market.localTxBuilding = true
+		return nil
+	}
+}
+
+/**
+ * Set the broker fee address and scale written into locally built orders, server-built orders must carry the same
+ * 设置本地组装订单中的手续费地址和手续费比例，服务端组装的订单也必须与之一致
+ */
+func WithBrokerFee(address string, scale byte) Option {
+	return func(config *marketConfig) error {
+		if _, err := addressBytes(address); err != nil {
+			return fmt.Errorf("fee address: %w", err)
+		}
+		config.market.feeAddress = address
+		config.market.feeScale = scale
+		return nil
+	}
+}
+
+// nonces of our own accounts, keyed by address and asset; a built order advances its nonce at once, so the next order
+// can be built while the first is still signed and broadcast
+type nonceCache struct {
+	mu		sync.Mutex
+	nonces	map[string][]byte
+}
+
+// a nonce taken by a locally built order that is not broadcast yet, the cache holds next until it settles
+type nonceReservation struct {
+	key		string
+	nonce	[]byte
+	next	[]byte
+}
+
+func nonceKey(address []byte, chainId, assetId uint16) string {
+	return fmt.Sprintf("%x/%d-%d", address, chainId, assetId)
+}
+
+// the nonce of the asset the order locks, as reported by the ledger
+func (market *Market) ledgerNonce(ctx context.Context, address string, symbol *Symbol, side Side) ([]byte, error) {
+	assetName := symbol.QuoteAssetName
+	if side == SideSell {
+		assetName = symbol.BaseAssetName
+	}
+	balances, err := market.GetBalanceByAddressCtx(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	for _, balance := range balances {
+		if strings.EqualFold(balance.AssetName, assetName) {
+			nonce, err := hex.DecodeString(balance.Nonce)
+			if err != nil || len(nonce) != 8 {
+				return nil, fmt.Errorf("invalid nonce %q of %s", balance.Nonce, assetName)
+			}
+			return nonce, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s balance on %s", assetName, address)
+}
+
+// build the order of intent on the cached nonce of its locked asset and reserve that nonce, nonces.mu is only held
+// while the tx is put together; the ledger is asked outside the lock when the asset has no cached nonce
+func (market *Market) buildLocalOrder(ctx context.Context, intent *TxIntent) (string, *nonceReservation, error) {
+	// an undeclared pair fails before the ledger is asked
+	if _, err := intent.Symbol.tradingHash(); err != nil {
+		return "", nil, err
+	}
+	raw, err := addressBytes(intent.Address)
+	if err != nil {
+		return "", nil, err
+	}
+	chainId, assetId, _ := lockedAsset(intent.Symbol, intent.Side, new(big.Int), new(big.Int))
+	key := nonceKey(raw, chainId, assetId)
+	for {
+		market.nonces.mu.Lock()
+		if nonce, ok := market.nonces.nonces[key]; ok {
+			tx, err := BuildOrderTx(&OrderTxParams{
+				Symbol: intent.Symbol,
+				Address: intent.Address,
+				Side: intent.Side,
+				Price: intent.Price,
+				Quantity: intent.Quantity,
+				Nonce: nonce,
+				FeeAddress: intent.FeeAddress,
+				FeeScale: intent.FeeScale,
+				Time: market.Now(),
+			})
+			if err != nil {
+				market.nonces.mu.Unlock()
+				return "", nil, err
+			}
+			// the hash leaves out the signature, so the nonce after this order is known before it is signed
+			next, _ := NonceFromTxHash(tx.GetHash().String())
+			market.nonces.nonces[key] = next
+			market.nonces.mu.Unlock()
+			txBytes, err := tx.Serialize()
+			if err != nil {
+				market.settleNonce(&nonceReservation{key: key, nonce: nonce, next: next}, false, nil)
+				return "", nil, err
+			}
+			return hex.EncodeToString(txBytes), &nonceReservation{key: key, nonce: nonce, next: next}, nil
+		}
+		market.nonces.mu.Unlock()
+
+		nonce, err := market.ledgerNonce(ctx, intent.Address, intent.Symbol, intent.Side)
+		if err != nil {
+			return "", nil, err
+		}
+		market.nonces.mu.Lock()
+		if market.nonces.nonces == nil {
+			market.nonces.nonces = map[string][]byte{}
+		}
+		// a concurrent order may have cached it first
+		if _, ok := market.nonces.nonces[key]; !ok {
+			market.nonces.nonces[key] = nonce
+		}
+		market.nonces.mu.Unlock()
+	}
+}
+
+// a broadcast order keeps the advanced nonce. One that was never broadcast gives its nonce back unless another order
+// was built on top of it, then the cache is dropped. After a failed broadcast the chain state is unknown and the
+// ledger is asked again
+func (market *Market) settleNonce(reservation *nonceReservation, broadcasted bool, broadcastErr error) {
+	if reservation == nil || (broadcasted && broadcastErr == nil) {
+		return
+	}
+	market.nonces.mu.Lock()
+	defer market.nonces.mu.Unlock()
+	current, ok := market.nonces.nonces[reservation.key]
+	if !broadcasted && ok && bytes.Equal(current, reservation.next) {
+		market.nonces.nonces[reservation.key] = reservation.nonce
+		return
+	}
+	delete(market.nonces.nonces, reservation.key)
+}
+
+// a server-built tx spent coins of our account, the locally built orders continue from its hash
+func (market *Market) updateNonces(decoded *DecodedTx, broadcastErr error) {
+	market.nonces.mu.Lock()
+	defer market.nonces.mu.Unlock()
+	if market.nonces.nonces == nil {
+		market.nonces.nonces = map[string][]byte{}
+	}
+	nonce, _ := NonceFromTxHash(decoded.Tx.GetHash().String())
+	for _, from := range decoded.CoinData.Froms {
+		key := nonceKey(from.Address, from.AssetsChainId, from.AssetsId)
+		if broadcastErr != nil {
+			delete(market.nonces.nonces, key)
+		} else {
+			market.nonces.nonces[key] = nonce
+		}
+	}
+}
+
+// the tx hex of intent built by the server
+func (market *Market) buildTx(ctx context.Context, intent *TxIntent) (string, error) {
+	newOrderResponse := &NewOrderResponse{}
+	if intent.TxType == TxTypeTradingOrderCancel {
+		// the cancel format is not documented, cancels are always built by the server and verified before signing
+		params := map[string]interface{} {
+			"orderId":intent.OrderId,
+		}
+		err := market.requestPost(ctx, ClassOrder, "/api/cancelOrder", params, newOrderResponse)
+		return newOrderResponse.Data, err
+	}
+	params := map[string]interface{} {
+		"address":intent.Address,
+		"symbol":intent.Symbol.Symbol,
+		"quantity":intent.Quantity,
+		"price":intent.Price,
+		"type":intent.Side,
+	}
+	err := market.requestPost(ctx, ClassOrder, "/api/order", params, newOrderResponse)
+	return newOrderResponse.Data, err
+}
+
+/**
+ * Build, verify, sign and broadcast the tx of intent, returns the tx hash
+ * 组装、校验、签名并广播 intent 对应的交易，返回交易hash
+ */
+func (market *Market) submitTx(ctx context.Context, signer Signer, intent *TxIntent) (string, error) {
+	var txHex string
+	var reservation *nonceReservation
+	var err error
+	if market.localTxBuilding && intent.TxType == TxTypeTradingOrder {
+		txHex, reservation, err = market.buildLocalOrder(ctx, intent)
+	} else {
+		txHex, err = market.buildTx(ctx, intent)
+	}
+	if err != nil {
+		return "", err
+	}
+	// locally built txs are verified too, the policies see every tx that is signed
+	decoded, err := market.verifyTx(txHex, intent)
+	if err != nil {
+		market.settleNonce(reservation, false, nil)
+		return "", err
+	}
+	tx := decoded.Tx
+	if err := signTx(ctx, signer, tx); err != nil {
+		market.settleNonce(reservation, false, nil)
+		return "", err
+	}
+	txHash, err := market.broadcast(ctx, tx)
+	if reservation != nil {
+		market.settleNonce(reservation, true, err)
+	} else if market.localTxBuilding && len(decoded.CoinData.Froms) > 0 {
+		// a server-built cancel that spends our coins moves the nonces of the locally built orders too
+		market.updateNonces(decoded, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return txHash, nil
+}
@@ -0,0 +1,263 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/9 下午4:20
+ */
+package ndex
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niels1286/nuls-go-sdk/account"
+)
+
+func testSymbol() *Symbol {
+	return &Symbol{
+		Symbol: "NVTNULS", BaseAssetName: "NVT", BaseDecimal: 8, QuoteAssetName: "NULS", QuoteDecimal: 8,
+		BaseMinTradingAmount: NewDecimalFromInt(1),
+		Hash: "5b1c0d7f3b1e0c2a9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c",
+		BaseAssetChainId: 5, BaseAssetId: 1, QuoteAssetChainId: 2, QuoteAssetId: 1,
+	}
+}
+
+func TestBuildOrderTx(t *testing.T) {
+	nonce := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	params := &OrderTxParams{
+		Symbol: testSymbol(), Address: testAddress, Side: SideBuy,
+		Price: MustParseDecimal("0.3"), Quantity: MustParseDecimal("12.5"),
+		Nonce: nonce, Time: time.Unix(1591344000, 0),
+	}
+	tx, err := BuildOrderTx(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txBytes, _ := tx.Serialize()
+	decoded, err := DecodeTx(hex.EncodeToString(txBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := decoded.CoinData.Froms[0]
+	// a buy locks 12.5 * 0.3 = 3.75 NULS
+	if from.AssetsChainId != 2 || from.Amount.String() != "375000000" || !bytes.Equal(from.Nonce, nonce) {
+		t.Errorf("locked coin %d-%d %s nonce %x", from.AssetsChainId, from.AssetsId, from.Amount, from.Nonce)
+	}
+	if decoded.CoinData.Tos[0].LockValue != lockedByOrder || !bytes.Equal(decoded.Order.FeeAddress, account.AddressStrToBytes(testAddress)) {
+		t.Errorf("unexpected to %+v, fee address %x", decoded.CoinData.Tos[0], decoded.Order.FeeAddress)
+	}
+	if err := checkTx(&TxIntent{TxType: TxTypeTradingOrder, Address: testAddress, Symbol: params.Symbol, Side: SideBuy, Price: params.Price, Quantity: params.Quantity}, decoded); err != nil {
+		t.Error(err)
+	}
+
+	params.Side = SideSell
+	tx, _ = BuildOrderTx(params)
+	txBytes, _ = tx.Serialize()
+	decoded, _ = DecodeTx(hex.EncodeToString(txBytes))
+	if from := decoded.CoinData.Froms[0]; from.AssetsChainId != 5 || from.Amount.String() != "1250000000" {
+		t.Errorf("sell locked %d-%d %s", from.AssetsChainId, from.AssetsId, from.Amount)
+	}
+
+	params.Symbol = &Symbol{Symbol: "NVTUSDT", BaseDecimal: 8, QuoteDecimal: 6, BaseMinTradingAmount: NewDecimalFromInt(10)}
+	params.Quantity = NewDecimalFromInt(10)
+	if _, err := BuildOrderTx(params); err == nil {
+		t.Error("symbol without asset ids was built")
+	}
+}
+
+func TestMarket_LocalTxBuilding(t *testing.T) {
+	var ledgerCalls, buildCalls, cancelBuilds int32
+	var broadcasts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tradings":
+			// the recorded payload has no trading hashes or asset ids, they are declared with WithTradingPair
+			serveTestdata(t, w, "tradings.json")
+		case "/api/ledger/" + testAddress:
+			atomic.AddInt32(&ledgerCalls, 1)
+			serveTestdata(t, w, "ledger.json")
+		case "/api/broadcast":
+			body, _ := ioutil.ReadAll(r.Body)
+			params := map[string]string{}
+			json.Unmarshal(body, &params)
+			broadcasts = append(broadcasts, params["txHex"])
+			decoded, _ := DecodeTx(params["txHex"])
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": decoded.Tx.GetHash().String()})
+		case "/api/cancelOrder":
+			// the cancel format is undocumented, cancels are still built by the server
+			atomic.AddInt32(&cancelBuilds, 1)
+			body, _ := ioutil.ReadAll(r.Body)
+			params := map[string]interface{}{}
+			json.Unmarshal(body, &params)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": encodeTestTx(buildTestTx(r.URL.Path, params))})
+		default:
+			atomic.AddInt32(&buildCalls, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithLocalTxBuilding()); err == nil {
+		t.Error("local tx building was accepted without any trading pair")
+	}
+	m, err := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey), WithLocalTxBuilding(),
+		WithTradingPair(testTradingPair()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.NewOrderCtx(ctx, "NVTUSDT", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5")); err == nil {
+		t.Error("an order of an undeclared pair was built")
+	}
+	first, err := m.NewOrderCtx(ctx, "NVTNULS", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.NewOrderCtx(ctx, "NVTNULS", SideBuy, MustParseDecimal("0.31"), MustParseDecimal("2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CancelOrderCtx(ctx, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&buildCalls); n != 0 {
+		t.Errorf("%d orders were built by the server", n)
+	}
+	if n := atomic.LoadInt32(&cancelBuilds); n != 1 {
+		t.Errorf("%d cancels were built by the server, want 1", n)
+	}
+	if n := atomic.LoadInt32(&ledgerCalls); n != 1 {
+		t.Errorf("ledger asked %d times, want 1", n)
+	}
+	if len(broadcasts) != 3 {
+		t.Fatalf("%d broadcasts", len(broadcasts))
+	}
+	for _, txHex := range broadcasts {
+		verifyBroadcastTx(t, txHex)
+	}
+	firstTx, _ := DecodeTx(broadcasts[0])
+	secondTx, _ := DecodeTx(broadcasts[1])
+	chained, _ := NonceFromTxHash(first.Id)
+	// the NULS nonce of testdata/ledger.json, then the one following our own first order
+	if hex.EncodeToString(firstTx.CoinData.Froms[0].Nonce) != "0000000000000000" || !bytes.Equal(secondTx.CoinData.Froms[0].Nonce, chained) {
+		t.Errorf("nonces %x then %x", firstTx.CoinData.Froms[0].Nonce, secondTx.CoinData.Froms[0].Nonce)
+	}
+}
+
+func TestMarket_LocalTxBuildingSlowBroadcast(t *testing.T) {
+	var ledgerCalls int32
+	var mu sync.Mutex
+	var slowTx string
+	slow, release := make(chan struct{}), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tradings":
+			serveTestdata(t, w, "tradings.json")
+		case "/api/ledger/" + testAddress:
+			atomic.AddInt32(&ledgerCalls, 1)
+			serveTestdata(t, w, "ledger.json")
+		case "/api/broadcast":
+			body, _ := ioutil.ReadAll(r.Body)
+			params := map[string]string{}
+			json.Unmarshal(body, &params)
+			mu.Lock()
+			first := slowTx == ""
+			if first {
+				slowTx = params["txHex"]
+			}
+			failing := slowTx == params["txHex"]
+			mu.Unlock()
+			if first {
+				// the first broadcast hangs and then fails
+				close(slow)
+				<-release
+			}
+			if failing {
+				fmt.Fprint(w, `{"code":1,"success":false,"msg":"broadcast failed"}`)
+				return
+			}
+			decoded, _ := DecodeTx(params["txHex"])
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": decoded.Tx.GetHash().String()})
+		}
+	}))
+	defer server.Close()
+
+	m, err := NewMarket(WithHost(server.URL), WithAddress(testAddress), WithPrivateKey(testPrivateKey), WithLocalTxBuilding(),
+		WithTradingPair(testTradingPair()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan error, 1)
+	go func() {
+		_, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, MustParseDecimal("0.3"), MustParseDecimal("12.5"))
+		failed <- err
+	}()
+	<-slow
+
+	// the next order is built on the nonce after the hanging one and does not wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.NewOrderCtx(ctx, "NVTNULS", SideBuy, MustParseDecimal("0.31"), MustParseDecimal("2")); err != nil {
+		t.Fatalf("an order waited for another broadcast: %v", err)
+	}
+	close(release)
+	if err := <-failed; err == nil {
+		t.Fatal("the failed broadcast returned no error")
+	}
+
+	// the failed broadcast dropped the cached nonce, the ledger is asked again
+	if _, err := m.NewOrderCtx(context.Background(), "NVTNULS", SideBuy, MustParseDecimal("0.32"), MustParseDecimal("2")); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&ledgerCalls); n != 2 {
+		t.Errorf("ledger asked %d times, want 2", n)
+	}
+}
+
+func TestMarket_LocalTxBuildingRollback(t *testing.T) {
+	m := &Market{}
+	key := "k"
+	m.nonces.nonces = map[string][]byte{key: {2}}
+	// nothing was built on top, the nonce is given back
+	m.settleNonce(&nonceReservation{key: key, nonce: []byte{1}, next: []byte{2}}, false, nil)
+	if !bytes.Equal(m.nonces.nonces[key], []byte{1}) {
+		t.Errorf("nonce %x after a rollback", m.nonces.nonces[key])
+	}
+	// another order used the next nonce, the cache is dropped
+	m.nonces.nonces[key] = []byte{3}
+	m.settleNonce(&nonceReservation{key: key, nonce: []byte{1}, next: []byte{2}}, false, nil)
+	if _, ok := m.nonces.nonces[key]; ok {
+		t.Error("a nonce others built on was rolled back")
+	}
+}
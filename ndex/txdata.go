@@ -0,0 +1,164 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/8 上午10:30
+ */
+package ndex
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	txprotocal "github.com/niels1286/nuls-go-sdk/tx/protocal"
+	"github.com/niels1286/nuls-go-sdk/utils/seria"
+)
+
+// Nerve dex transaction types
+const (
+	TxTypeTradingOrder			uint16 = 229	// 挂单委托
+	TxTypeTradingOrderCancel	uint16 = 230	// 取消委托
+)
+
+/**
+ * txData of a TRADING_ORDER transaction, serialized as tradingHash(32) address(23) type(1) amount(uint256) price(uint256) feeAddress(varbytes) feeScale(1)
+ * 挂单委托交易的 txData
+ */
+type TradingOrderData struct {
+	TradingHash	[]byte		//交易对hash
+	Address		[]byte		//委托地址
+	Type		Side		//委托类型，1买，2卖
+	Amount		*big.Int	//委托数量（交易资产的最小单位）
+	Price		*big.Int	//委托价格（计价资产的最小单位）
+	FeeAddress	[]byte		//手续费收取地址
+	FeeScale	byte		//手续费比例
+}
+
+/**
+ * txData of a TRADING_ORDER_CANCEL transaction, the 32 byte hash of the order tx
+ * 取消委托交易的 txData
+ */
+type CancelOrderData struct {
+	OrderHash	[]byte
+}
+
+func (data *TradingOrderData) Serialize() []byte {
+	writer := seria.NewByteBufWriter()
+	writer.WriteBytes(data.TradingHash)
+	writer.WriteBytes(data.Address)
+	writer.WriteByte(byte(data.Type))
+	writer.WriteBigint(data.Amount)
+	writer.WriteBigint(data.Price)
+	writer.WriteBytesWithLen(data.FeeAddress)
+	writer.WriteByte(data.FeeScale)
+	return writer.Serialize()
+}
+
+func ParseTradingOrderData(txData []byte) (data *TradingOrderData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			data, err = nil, fmt.Errorf("invalid trading order data: %v", r)
+		}
+	}()
+	reader := seria.NewByteBufReader(txData, 0)
+	data = &TradingOrderData{}
+	data.TradingHash, _ = reader.ReadBytes(32)
+	data.Address, _ = reader.ReadBytes(23)
+	side, _ := reader.ReadByte()
+	data.Type = Side(side)
+	data.Amount, _ = reader.ReadBigInt()
+	data.Price, _ = reader.ReadBigInt()
+	data.FeeAddress, _ = reader.ReadBytesWithLen()
+	data.FeeScale, _ = reader.ReadByte()
+	if !bytes.Equal(data.Serialize(), txData) {
+		return nil, errors.New("invalid trading order data")
+	}
+	return data, nil
+}
+
+func (data *CancelOrderData) Serialize() []byte {
+	return append([]byte(nil), data.OrderHash...)
+}
+
+func ParseCancelOrderData(txData []byte) (*CancelOrderData, error) {
+	if len(txData) != 32 {
+		return nil, fmt.Errorf("cancel order data must be 32 bytes, got %d", len(txData))
+	}
+	return &CancelOrderData{OrderHash: append([]byte(nil), txData...)}, nil
+}
+
+/**
+ * DecodedTx is an unsigned dex transaction with its coin data and txData decoded
+ * DecodedTx 为解析了 coinData 和 txData 的未签名 dex 交易
+ */
+type DecodedTx struct {
+	Tx			*txprotocal.Transaction
+	CoinData	*txprotocal.CoinData
+	Order		*TradingOrderData	// set for TxTypeTradingOrder
+	Cancel		*CancelOrderData	// set for TxTypeTradingOrderCancel
+}
+
+/**
+ * Decode the unsigned tx hex returned by /api/order or /api/cancelOrder, any trailing or missing byte is an error
+ * 解析 /api/order 或 /api/cancelOrder 返回的未签名交易，多余或缺失的字节都会返回错误
+ */
+func DecodeTx(txHex string) (decoded *DecodedTx, err error) {
+	// the seria readers index past the end of truncated input
+	defer func() {
+		if r := recover(); r != nil {
+			decoded, err = nil, fmt.Errorf("malformed tx: %v", r)
+		}
+	}()
+	txBytes, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, fmt.Errorf("tx is not valid hex: %w", err)
+	}
+	// the seria readers return empty values instead of errors on short input, so every part has to
+	// serialize back to exactly the bytes it was parsed from
+	tx := txprotocal.ParseTransactionByReader(seria.NewByteBufReader(txBytes, 0))
+	if serialized, _ := tx.Serialize(); !bytes.Equal(serialized, txBytes) {
+		return nil, errors.New("malformed tx")
+	}
+	decoded = &DecodedTx{Tx: tx, CoinData: &txprotocal.CoinData{}}
+	if len(tx.CoinData) > 0 {
+		decoded.CoinData.Parse(seria.NewByteBufReader(tx.CoinData, 0))
+		if serialized, _ := decoded.CoinData.Serialize(); !bytes.Equal(serialized, tx.CoinData) {
+			return nil, errors.New("malformed tx: invalid coin data")
+		}
+	}
+	switch tx.TxType {
+	case TxTypeTradingOrder:
+		decoded.Order, err = ParseTradingOrderData(tx.Extend)
+	case TxTypeTradingOrderCancel:
+		decoded.Cancel, err = ParseCancelOrderData(tx.Extend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("malformed tx data: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,236 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/4 上午10:15
+ */
+package ndex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Order side, 1 buy, 2 sell
+ * 订单方向，1买，2卖
+ */
+type Side int
+
+const (
+	SideBuy  Side = 1
+	SideSell Side = 2
+)
+
+/**
+ * Order status, 1 open, 2 partially filled, 3 filled, 4 cancelled, 5 partially filled then cancelled
+ * 委托单状态 1：挂单中，2:部分成交、3:已成交 、4已撤销、5，部分成交已撤单
+ */
+type OrderStatus int
+
+const (
+	OrderStatusOpen               OrderStatus = 1
+	OrderStatusPartiallyFilled    OrderStatus = 2
+	OrderStatusFilled             OrderStatus = 3
+	OrderStatusCancelled          OrderStatus = 4
+	OrderStatusPartiallyCancelled OrderStatus = 5
+)
+
+/**
+ * Kline interval, the raw type code of /api/kline. The server does not document which period each code stands for,
+ * so the codes are named by number; check the candle times of a response before relying on one
+ * K线周期，即 /api/kline 的原始 type 参数。服务器未说明各取值对应的周期，因此常量按数字命名；使用前请根据返回K线的时间确认
+ */
+type KlineInterval int
+
+const (
+	KlineType1 KlineInterval = 1
+	KlineType2 KlineInterval = 2
+	KlineType3 KlineInterval = 3
+	KlineType4 KlineInterval = 4
+	KlineType5 KlineInterval = 5
+	KlineType6 KlineInterval = 6
+	KlineType7 KlineInterval = 7
+	KlineType8 KlineInterval = 8
+)
+
+var sideNames = map[Side]string{
+	SideBuy:  "buy",
+	SideSell: "sell",
+}
+
+var orderStatusNames = map[OrderStatus]string{
+	OrderStatusOpen:               "open",
+	OrderStatusPartiallyFilled:    "partially_filled",
+	OrderStatusFilled:             "filled",
+	OrderStatusCancelled:          "cancelled",
+	OrderStatusPartiallyCancelled: "partially_cancelled",
+}
+
+func (side Side) Valid() bool {
+	_, ok := sideNames[side]
+	return ok
+}
+
+func (side Side) String() string {
+	if name, ok := sideNames[side]; ok {
+		return name
+	}
+	return fmt.Sprintf("Side(%d)", int(side))
+}
+
+/**
+ * Get the opposite side
+ * 获取相反的订单方向
+ */
+func (side Side) Opposite() Side {
+	switch side {
+	case SideBuy:
+		return SideSell
+	case SideSell:
+		return SideBuy
+	}
+	return side
+}
+
+func (side Side) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(side))
+}
+
+func (side *Side) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalEnum(data, "side", func(name string) (int, bool) {
+		for k, v := range sideNames {
+			if v == strings.ToLower(name) {
+				return int(k), true
+			}
+		}
+		return 0, false
+	})
+	if err != nil {
+		return err
+	}
+	*side = Side(value)
+	return nil
+}
+
+func (status OrderStatus) Valid() bool {
+	_, ok := orderStatusNames[status]
+	return ok
+}
+
+func (status OrderStatus) String() string {
+	if name, ok := orderStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("OrderStatus(%d)", int(status))
+}
+
+/**
+ * Whether the order is still on the order book and can be filled or cancelled
+ * 订单是否仍在盘口中，可继续成交或撤销
+ */
+func (status OrderStatus) IsOpen() bool {
+	return status == OrderStatusOpen || status == OrderStatusPartiallyFilled
+}
+
+/**
+ * Whether the order has reached a final status and will never change again
+ * 订单是否已到达最终状态，不会再发生变化
+ */
+func (status OrderStatus) IsFinal() bool {
+	return status == OrderStatusFilled || status == OrderStatusCancelled || status == OrderStatusPartiallyCancelled
+}
+
+func (status OrderStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(status))
+}
+
+func (status *OrderStatus) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalEnum(data, "order status", func(name string) (int, bool) {
+		for k, v := range orderStatusNames {
+			if v == strings.ToLower(name) {
+				return int(k), true
+			}
+		}
+		return 0, false
+	})
+	if err != nil {
+		return err
+	}
+	*status = OrderStatus(value)
+	return nil
+}
+
+// codes are positive, which ones the server accepts is up to the server
+func (interval KlineInterval) Valid() bool {
+	return interval > 0
+}
+
+func (interval KlineInterval) String() string {
+	return fmt.Sprintf("KlineInterval(%d)", int(interval))
+}
+
+func (interval KlineInterval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(interval))
+}
+
+// only the raw code is accepted, there are no names to match
+func (interval *KlineInterval) UnmarshalJSON(data []byte) error {
+	value, err := unmarshalEnum(data, "kline interval", func(name string) (int, bool) {
+		return 0, false
+	})
+	if err != nil {
+		return err
+	}
+	*interval = KlineInterval(value)
+	return nil
+}
+
+/**
+ * Decode an enum sent either as a number or as its name, unknown numbers are kept so that new server values do not break decoding
+ * 解析以数字或名称形式发送的枚举值，未知的数字会被保留，避免服务端新增取值导致解析失败
+ */
+func unmarshalEnum(data []byte, kind string, byName func(string) (int, bool)) (int, error) {
+	if string(data) == "null" {
+		return 0, nil
+	}
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		return number, nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return 0, fmt.Errorf("invalid %s %s", kind, data)
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		return number, nil
+	}
+	if value, ok := byName(name); ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("unknown %s %q", kind, name)
+}
@@ -0,0 +1,101 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/4 上午11:40
+ */
+package ndex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTypes_JSON(t *testing.T) {
+	var order Order
+	if err := json.Unmarshal([]byte(`{"type":"sell","status":5}`), &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Type != SideSell || order.Status != OrderStatusPartiallyCancelled {
+		t.Errorf("decoded %s %s", order.Type, order.Status)
+	}
+	if err := json.Unmarshal([]byte(`{"type":1,"status":"open"}`), &order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Type != SideBuy || order.Status != OrderStatusOpen {
+		t.Errorf("decoded %s %s", order.Type, order.Status)
+	}
+	if err := json.Unmarshal([]byte(`{"type":"hold"}`), &order); err == nil {
+		t.Error("unknown side name was accepted")
+	}
+	var interval KlineInterval
+	if err := json.Unmarshal([]byte(`8`), &interval); err != nil || interval != KlineType8 {
+		t.Errorf("decoded %s, %v", interval, err)
+	}
+	if err := json.Unmarshal([]byte(`"1M"`), &interval); err == nil {
+		t.Error("a made-up interval name was accepted")
+	}
+	encoded, _ := json.Marshal(map[string]interface{}{"type": SideSell, "status": OrderStatusFilled, "interval": KlineType5})
+	if string(encoded) != `{"interval":5,"status":3,"type":2}` {
+		t.Errorf("encoded %s", encoded)
+	}
+}
+
+func TestTypes_OrderStatus(t *testing.T) {
+	for status := OrderStatusOpen; status <= OrderStatusPartiallyCancelled; status++ {
+		if !status.Valid() || status.IsOpen() == status.IsFinal() {
+			t.Errorf("%s: open=%v final=%v", status, status.IsOpen(), status.IsFinal())
+		}
+	}
+	if OrderStatus(6).Valid() || OrderStatus(6).IsOpen() || OrderStatus(6).IsFinal() {
+		t.Error("unknown status is treated as known")
+	}
+	if SideBuy.Opposite() != SideSell || Side(3).String() != "Side(3)" {
+		t.Error("unexpected side helpers")
+	}
+}
+
+func TestMarket_RejectsInvalidEnums(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	m := &Market{Host: server.URL}
+	if _, err := m.NewOrderByAddressCtx(context.Background(), "TNVTdTSPPkqrEL9RuiiTUk4ivn6hfRiNt9giD", "1b0470a2a8c8a02c5dee364fd6d0f56dc7e30a4a817c18b4b00c419c349dc7df", "NVTNULS", Side(0), NewDecimalFromInt(1), NewDecimalFromInt(1)); err == nil {
+		t.Error("invalid side was accepted")
+	}
+	if _, err := m.KlineCtx(context.Background(), "NVTNULS", KlineInterval(0), 10); err == nil {
+		t.Error("invalid interval was accepted")
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("%d requests were sent", n)
+	}
+}
@@ -0,0 +1,399 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/22 下午2:30
+ */
+package ndex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+	"github.com/gorilla/websocket"
+)
+
+type ConnState int
+
+const (
+	ConnStateClosed ConnState = iota	// never connected, or closed for good
+	ConnStateConnecting
+	ConnStateConnected
+	ConnStateReconnecting
+)
+
+func (state ConnState) String() string {
+	switch state {
+	case ConnStateClosed:
+		return "closed"
+	case ConnStateConnecting:
+		return "connecting"
+	case ConnStateConnected:
+		return "connected"
+	case ConnStateReconnecting:
+		return "reconnecting"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(state))
+}
+
+/**
+ * A transition of the websocket connection state. A failed reconnect attempt is reported as
+ * Reconnecting -> Reconnecting with the attempt number and its error
+ * websocket 连接状态的一次变化。重连失败时报告为 Reconnecting -> Reconnecting，并附带尝试次数及错误
+ */
+type ConnStateChange struct {
+	From	ConnState
+	To		ConnState
+	Attempt	int		// reconnect attempt, 0 for the first connection
+	Err		error	// why the connection was lost, or why the attempt failed
+	Time	time.Time
+}
+
+/**
+ * Delays between reconnect attempts: 1s doubling up to 1 minute, with jitter
+ * 重连间隔：从 1 秒开始翻倍，最长 1 分钟，带随机抖动
+ */
+var DefaultReconnectBackoff = utils.Backoff{
+	Initial:	time.Second,
+	Max:		time.Minute,
+	Multiplier:	2,
+	Jitter:		0.2,
+}
+
+// queued on readChannel after a reconnect so messageHandler signals the subscribers before any new message
+const resyncMarker = "\x00resync"
+
+// queued on writeChannel by Close, the writer answers it with a close frame and stops writing
+const closeMarker = "\x00close"
+
+// how long Close waits for the server to answer the close frame
+const closeHandshakeTimeout = 5 * time.Second
+
+// how many state changes are buffered for a slow reader of StateChanges
+const stateChangesBuffer = 32
+
+func (ws *NdexWs) State() ConnState {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.state
+}
+
+/**
+ * Channel of connection state changes. Changes are dropped while the buffer is full, State always returns the latest state
+ * 连接状态变化的 channel。缓冲区满时会丢弃变化，State 始终返回最新状态
+ */
+func (ws *NdexWs) StateChanges() <-chan ConnStateChange {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.stateChanges == nil {
+		ws.stateChanges = make(chan ConnStateChange, stateChangesBuffer)
+	}
+	return ws.stateChanges
+}
+
+// callers hold ws.mu, so changes are queued in the order they happen
+func (ws *NdexWs) setState(to ConnState, attempt int, err error) {
+	change := ConnStateChange{From: ws.state, To: to, Attempt: attempt, Err: err, Time: time.Now()}
+	ws.state = to
+	if ws.stateChanges != nil {
+		select {
+		case ws.stateChanges <- change:
+		default:
+		}
+	}
+}
+
+// dial and start the handlers of a new connection; attempt is 0 for the first connection, reconnects resubscribe first
+func (ws *NdexWs) dial(ctx context.Context, attempt int) error {
+	dialer := ws.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	conn, _, err := dialer.DialContext(ctx, ws.Host + "/ws", ws.Header)
+	if err != nil {
+		return err
+	}
+	if attempt > 0 {
+		// written before the new writer starts, which would otherwise write concurrently
+		for _, msg := range ws.subscriptions.subMessages() {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+	}
+
+	ws.mu.Lock()
+	if ws.state == ConnStateClosed {
+		ws.mu.Unlock()
+		conn.Close()
+		return ErrWsClosed
+	}
+	done, readDone := make(chan struct{}), make(chan struct{})
+	stopped := ws.stopped
+	ws.conn, ws.connDone, ws.readDone = conn, done, readDone
+	ws.setState(ConnStateConnected, attempt, nil)
+	ws.handlers.Add(3)
+	ws.mu.Unlock()
+	ws.heartbeat.connected(attempt > 0)
+
+	if attempt > 0 {
+		select {
+		case ws.readChannel <- resyncMarker:
+		case <- stopped:
+		}
+	}
+	go ws.readHandler(conn, done, readDone)
+	go ws.writeHandler(conn, done)
+	go ws.pingHandler(conn, done)
+	return nil
+}
+
+// called by the handlers of conn when it fails, only the first call for the current connection starts reconnecting
+func (ws *NdexWs) connectionLost(conn *websocket.Conn, err error) {
+	ws.mu.Lock()
+	// while closing, the connection is left to shutdown
+	if ws.conn != conn || ws.closing {
+		ws.mu.Unlock()
+		return
+	}
+	close(ws.connDone)
+	conn.Close()
+	ws.conn, ws.connDone, ws.readDone = nil, nil, nil
+	ws.setState(ConnStateReconnecting, 0, err)
+	ws.handlers.Add(1)
+	ws.mu.Unlock()
+	go ws.reconnectLoop()
+}
+
+func (ws *NdexWs) reconnectLoop() {
+	defer ws.handlers.Done()
+	ws.mu.Lock()
+	stopped := ws.stopped
+	ws.mu.Unlock()
+	backoff := DefaultReconnectBackoff
+	if ws.ReconnectBackoff != nil {
+		backoff = *ws.ReconnectBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		if ws.MaxReconnectAttempts > 0 && attempt > ws.MaxReconnectAttempts {
+			ws.shutdown(fmt.Errorf("ndex websocket gave up after %d reconnect attempts", ws.MaxReconnectAttempts))
+			return
+		}
+		timer := time.NewTimer(backoff.Duration(attempt))
+		select {
+		case <- timer.C:
+		case <- stopped:
+			timer.Stop()
+			return
+		}
+		log.Println("ndex reConning...")
+		ctx, cancel := context.WithCancel(context.Background())
+		ws.handlers.Add(1)
+		go func() {
+			defer ws.handlers.Done()
+			select {
+			case <- stopped:
+				cancel()
+			case <- ctx.Done():
+			}
+		}()
+		err := ws.dial(ctx, attempt)
+		cancel()
+		if err == nil {
+			log.Println("ndex reConn success.")
+			return
+		}
+		if err == ErrWsClosed {
+			return
+		}
+		log.Println("ndex reConn error : ", err)
+		ws.mu.Lock()
+		if ws.state == ConnStateReconnecting {
+			ws.setState(ConnStateReconnecting, attempt, err)
+		}
+		ws.mu.Unlock()
+	}
+}
+
+// move to ConnStateClosed for good: stop every handler and close the event channels of all subscribers
+func (ws *NdexWs) shutdown(err error) {
+	ws.mu.Lock()
+	if ws.state == ConnStateClosed {
+		ws.mu.Unlock()
+		return
+	}
+	if ws.conn != nil {
+		close(ws.connDone)
+		ws.conn.Close()
+		ws.conn, ws.connDone, ws.readDone = nil, nil, nil
+	}
+	close(ws.stopped)
+	ws.setState(ConnStateClosed, 0, err)
+	ws.mu.Unlock()
+	ws.subscriptions.closeAll()
+}
+
+/**
+ * Unsubscribe every channel, close the connection with a close handshake, close the event channels of all subscribers
+ * and wait for every goroutine of the websocket to return. ctx bounds the handshake and the wait, the websocket is
+ * closed either way. Closing a closed websocket only waits, it can be dialed again with ConnCtx
+ * 取消所有订阅，通过关闭握手断开连接，关闭所有订阅者的事件 channel，并等待 websocket 的所有 goroutine 退出。
+ * ctx 限制握手及等待的时间，无论如何 websocket 都会被关闭。关闭已关闭的 websocket 只会等待，之后可通过 ConnCtx 重新连接
+ */
+func (ws *NdexWs) Close(ctx context.Context) error {
+	ws.mu.Lock()
+	ws.closing = true
+	state, writeChannel, readDone := ws.state, ws.writeChannel, ws.readDone
+	ws.mu.Unlock()
+
+	var err error
+	if state == ConnStateConnected && readDone != nil {
+		err = ws.closeHandshake(ctx, writeChannel, readDone)
+	}
+	ws.shutdown(nil)
+	if waitErr := ws.wait(ctx); err == nil {
+		err = waitErr
+	}
+	return err
+}
+
+// queue the unsubscribe messages and the close frame behind anything already queued, then wait for the server's close frame
+func (ws *NdexWs) closeHandshake(ctx context.Context, writeChannel chan string, readDone chan struct{}) error {
+	for _, msg := range append(ws.subscriptions.unsubMessages(), closeMarker) {
+		select {
+		case writeChannel <- msg:
+		case <- readDone:
+			// the connection is already gone
+			return nil
+		case <- ctx.Done():
+			return ctx.Err()
+		}
+	}
+	// a subscriber that stopped reading would block the dispatch, and with it the reader that has to see the close frame
+	ws.subscriptions.closeAll()
+	timer := time.NewTimer(closeHandshakeTimeout)
+	defer timer.Stop()
+	select {
+	case <- readDone:
+		return nil
+	case <- timer.C:
+		// the server never answered, shutdown closes the connection anyway
+		return nil
+	case <- ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ws *NdexWs) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ws.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <- done:
+		return nil
+	case <- ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ws *NdexWs) readHandler(conn *websocket.Conn, done, readDone chan struct{}) {
+	defer ws.handlers.Done()
+	defer close(readDone)
+	for {
+		// a half-open connection delivers nothing, not even pongs
+		conn.SetReadDeadline(time.Now().Add(ws.readTimeout()))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				err = fmt.Errorf("%w: %v", ErrHeartbeatTimeout, err)
+			}
+			select {
+			case <- done:
+				// closed on purpose
+			default:
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					log.Println("ndex websocket close, " + err.Error())
+				}
+				ws.connectionLost(conn, err)
+			}
+			return
+		}
+		now := time.Now()
+		ws.heartbeat.received(now)
+		// recorded here, so a slow subscriber can not make a live connection look dead
+		if pong, ok := parsePong(message); ok {
+			ws.processPong(pong, now)
+			continue
+		}
+		select {
+		case ws.readChannel <- string(message):
+			continue
+		default:
+		}
+		// while the reader waits for messageHandler, unread pongs do not count as missed
+		ws.heartbeat.setBacklogged(true)
+		select {
+		case ws.readChannel <- string(message):
+			ws.heartbeat.setBacklogged(false)
+		case <- done:
+			ws.heartbeat.setBacklogged(false)
+			return
+		}
+	}
+}
+
+func (ws *NdexWs) writeHandler(conn *websocket.Conn, done chan struct{}) {
+	defer ws.handlers.Done()
+	for {
+		select {
+		case <- done:
+			return
+		case msg := <- ws.writeChannel:
+			if msg == closeMarker {
+				// the reader returns once the server answers with its own close frame
+				closeFrame := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				if err := conn.WriteMessage(websocket.CloseMessage, closeFrame); err != nil {
+					log.Println("ndex websocket write error, ", err)
+				}
+				return
+			}
+			if msg != "" {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+					log.Println("ndex websocket write error, ", err)
+					ws.connectionLost(conn, err)
+					return
+				}
+			}
+		}
+	}
+}
+
@@ -0,0 +1,340 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/22 下午2:30
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NerveNetwork/ndex-go-sdk/utils"
+)
+
+var testReconnectBackoff = &utils.Backoff{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond, Multiplier: 2}
+
+// wait for a change to the given state, failing the test after a second
+func waitState(t *testing.T, changes <-chan ConnStateChange, to ConnState) ConnStateChange {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case change := <-changes:
+			if change.To == to {
+				return change
+			}
+		case <-timeout:
+			t.Fatalf("no change to %s", to)
+		}
+	}
+}
+
+// wait until the stand-in received n messages with the given prefix
+func waitMessages(t *testing.T, standIn *wsStandIn, prefix string, n int) []string {
+	deadline := time.Now().Add(time.Second)
+	for {
+		messages := standIn.messages(prefix)
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %v, expected %d messages starting with %s", messages, n, prefix)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNdexWs_Reconnect(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{Host: standIn.wsHost(), ReconnectBackoff: testReconnectBackoff}
+	changes := ws.StateChanges()
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	if change := waitState(t, changes, ConnStateConnected); change.From != ConnStateConnecting || change.Attempt != 0 {
+		t.Errorf("first connection %+v", change)
+	}
+	event, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-event
+	waitMessages(t, standIn, `{"action":"Subscribe"`, 1)
+
+	standIn.dropAll()
+	if change := waitState(t, changes, ConnStateReconnecting); change.Err == nil {
+		t.Errorf("lost connection without error %+v", change)
+	}
+	if change := waitState(t, changes, ConnStateConnected); change.Attempt != 1 {
+		t.Errorf("reconnect %+v", change)
+	}
+
+	// the marker arrives before anything of the new connection
+	timeout := time.After(time.Second)
+	for resynced := false; !resynced; {
+		select {
+		case orderBook := <-event:
+			resynced = orderBook.Resync
+			if resynced && orderBook.Symbol != "S0" {
+				t.Errorf("resync marker for %s", orderBook.Symbol)
+			}
+		case <-timeout:
+			t.Fatal("no resync marker after the reconnect")
+		}
+	}
+	if subscribes := waitMessages(t, standIn, `{"action":"Subscribe"`, 2); subscribes[0] != subscribes[1] {
+		t.Errorf("subscribe messages %v", subscribes)
+	}
+	if ws.State() != ConnStateConnected {
+		t.Errorf("state %s", ws.State())
+	}
+	ws.shutdown(nil)
+}
+
+func TestNdexWs_ReconnectGivesUp(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{Host: standIn.wsHost(), ReconnectBackoff: testReconnectBackoff, MaxReconnectAttempts: 2}
+	changes := ws.StateChanges()
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	event, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&standIn.refuse, 1)
+	standIn.dropAll()
+	failed := 0
+	for change := waitState(t, changes, ConnStateReconnecting); change.To != ConnStateClosed; change = <-changes {
+		if change.From == ConnStateReconnecting && change.To == ConnStateReconnecting {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("%d failed attempts reported", failed)
+	}
+	// subscribers see their channel closed
+	timeout := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-event:
+		case <-timeout:
+			t.Fatal("event channel still open")
+		}
+	}
+	if _, err := ws.SubscribeOrderBook("S0", 10); !errors.Is(err, ErrWsClosed) {
+		t.Errorf("expected ErrWsClosed, got %v", err)
+	}
+
+	// a closed websocket can be dialed again
+	atomic.StoreInt32(&standIn.refuse, 0)
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	if ws.State() != ConnStateConnected {
+		t.Errorf("state %s", ws.State())
+	}
+	ws.shutdown(nil)
+}
+
+// wait until no more goroutines run than baseline, failing the test with their stacks after two seconds
+func waitGoroutines(t *testing.T, baseline int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			stacks := make([]byte, 1 << 20)
+			stacks = stacks[:runtime.Stack(stacks, true)]
+			t.Fatalf("%d goroutines leaked:\n%s", runtime.NumGoroutine() - baseline, stacks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// drain event until it is closed
+func waitClosed(t *testing.T, event chan *OrderBook) {
+	timeout := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-event:
+		case <-timeout:
+			t.Fatal("event channel still open")
+		}
+	}
+}
+
+func TestNdexWs_Close(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+	baseline := runtime.NumGoroutine()
+
+	ws := &NdexWs{Host: standIn.wsHost()}
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	books, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := ws.SubscribeOrderChange(testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-books
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ws.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ws.State() != ConnStateClosed {
+		t.Errorf("state %s", ws.State())
+	}
+	waitGoroutines(t, baseline)
+
+	// the server saw both unsubscribes before the close frame
+	if unsubscribes := standIn.messages(`{"action":"Unsubscribe"`); len(unsubscribes) != 2 {
+		t.Errorf("unsubscribe messages %v", unsubscribes)
+	}
+	standIn.mu.Lock()
+	closeCodes := standIn.closeCodes
+	standIn.mu.Unlock()
+	if len(closeCodes) != 1 || closeCodes[0] != 1000 {
+		t.Errorf("close frames %v", closeCodes)
+	}
+	waitClosed(t, books)
+	for range orders {
+	}
+
+	if err := ws.Close(ctx); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	if _, err := ws.SubscribeOrderBook("S0", 10); !errors.Is(err, ErrWsClosed) {
+		t.Errorf("expected ErrWsClosed, got %v", err)
+	}
+}
+
+func TestNdexWs_CloseWithStalledSubscriber(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+	baseline := runtime.NumGoroutine()
+
+	ws := &NdexWs{Host: standIn.wsHost()}
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	// never read, the stand-in fills the channel and the dispatch blocks
+	books, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a blocked reader", func() bool { return len(books) == cap(books) && len(ws.readChannel) == cap(ws.readChannel) })
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- ws.Close(context.Background())
+	}()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close hangs on a subscriber that stopped reading")
+	}
+	waitClosed(t, books)
+	waitGoroutines(t, baseline)
+}
+
+func TestNdexWs_CloseWhileReconnecting(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+	baseline := runtime.NumGoroutine()
+
+	ws := &NdexWs{Host: standIn.wsHost(), ReconnectBackoff: &utils.Backoff{Initial: time.Hour}}
+	changes := ws.StateChanges()
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	books, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standIn.dropAll()
+	waitState(t, changes, ConnStateReconnecting)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ws.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, books)
+	waitGoroutines(t, baseline)
+}
+
+func TestMarket_Close(t *testing.T) {
+	server := newHealthServer(t, 0)
+	defer server.Close()
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+	baseline := runtime.NumGoroutine()
+
+	m, err := NewMarket(WithHost(server.URL), WithWsHost(standIn.wsHost()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartClockSync(context.Background(), 10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	books, err := m.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-books
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, books)
+	waitGoroutines(t, baseline)
+}
+
+func TestMarket_CloseUninitialized(t *testing.T) {
+	m := &Market{}
+	if err := m.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
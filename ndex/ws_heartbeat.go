@@ -0,0 +1,198 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/24 下午3:10
+ */
+package ndex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	DefaultPingInterval		= 10 * time.Second
+	DefaultMaxMissedPongs	= 3
+)
+
+/**
+ * Liveness of the websocket, a monitor should alert when LastMessage gets old
+ * websocket 的存活情况，监控应在 LastMessage 过旧时告警
+ */
+type WsStats struct {
+	State		ConnState
+	Latency		time.Duration	// round trip of the latest answered ping
+	LastPing	time.Time
+	LastPong	time.Time
+	LastMessage	time.Time		// latest message of any kind, data or pong
+	MissedPongs	int				// pings sent since the latest pong
+	Reconnects	int				// successful reconnects since the websocket was created
+}
+
+// the heartbeat bookkeeping, updated by the reader, the pinger and messageHandler
+type heartbeat struct {
+	mu			sync.Mutex
+	latency		time.Duration
+	lastPing	time.Time
+	lastPong	time.Time
+	lastMessage	time.Time
+	missed		int
+	reconnects	int
+	backlogged	bool			// the reader is blocked on a full readChannel
+}
+
+func (hb *heartbeat) connected(reconnect bool) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.missed = 0
+	if reconnect {
+		hb.reconnects++
+	}
+}
+
+func (hb *heartbeat) pinged(at time.Time) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.lastPing = at
+	if !hb.backlogged {
+		hb.missed++
+	}
+}
+
+func (hb *heartbeat) setBacklogged(backlogged bool) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.backlogged = backlogged
+}
+
+// pingMillis is the timestamp echoed by the server, the exact send time is used when it is the latest ping
+func (hb *heartbeat) ponged(pingMillis int64, at time.Time) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	sent := fromMillis(pingMillis)
+	if hb.lastPing.UnixNano() / 1e6 == pingMillis {
+		sent = hb.lastPing
+	}
+	hb.latency = at.Sub(sent)
+	hb.lastPong = at
+	hb.missed = 0
+}
+
+func (hb *heartbeat) received(at time.Time) {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.lastMessage = at
+}
+
+func (hb *heartbeat) missedPongs() int {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return hb.missed
+}
+
+func (ws *NdexWs) Stats() WsStats {
+	state := ws.State()
+	ws.heartbeat.mu.Lock()
+	defer ws.heartbeat.mu.Unlock()
+	return WsStats{
+		State:			state,
+		Latency:		ws.heartbeat.latency,
+		LastPing:		ws.heartbeat.lastPing,
+		LastPong:		ws.heartbeat.lastPong,
+		LastMessage:	ws.heartbeat.lastMessage,
+		MissedPongs:	ws.heartbeat.missed,
+		Reconnects:		ws.heartbeat.reconnects,
+	}
+}
+
+func (ws *NdexWs) pingInterval() time.Duration {
+	if ws.PingInterval > 0 {
+		return ws.PingInterval
+	}
+	return DefaultPingInterval
+}
+
+func (ws *NdexWs) maxMissedPongs() int {
+	if ws.MaxMissedPongs > 0 {
+		return ws.MaxMissedPongs
+	}
+	return DefaultMaxMissedPongs
+}
+
+// the pinger notices missed pongs first, the read deadline is the fallback for a blocked writer
+func (ws *NdexWs) readTimeout() time.Duration {
+	return ws.pingInterval() * time.Duration(ws.maxMissedPongs() + 1)
+}
+
+// ping every interval, and drop conn once too many pings in a row went unanswered
+func (ws *NdexWs) pingHandler(conn *websocket.Conn, done chan struct{}) {
+	defer ws.handlers.Done()
+	ticker := time.NewTicker(ws.pingInterval())
+	defer ticker.Stop()
+	for {
+		if missed := ws.heartbeat.missedPongs(); missed >= ws.maxMissedPongs() {
+			err := fmt.Errorf("%w: %d pings unanswered", ErrHeartbeatTimeout, missed)
+			log.Println("ndex websocket close, ", err)
+			ws.connectionLost(conn, err)
+			return
+		}
+		now := time.Now()
+		msg := fmt.Sprintf("{\"ping\":%d}", now.UnixNano() / 1e6)
+		select {
+		case ws.writeChannel <- msg:
+			ws.heartbeat.pinged(now)
+		case <- done:
+			return
+		}
+		select {
+		case <- ticker.C:
+		case <- done:
+			return
+		}
+	}
+}
+
+func (ws *NdexWs) processPong(pong *WsPong, at time.Time) {
+	ws.heartbeat.ponged(pong.Pong, at)
+}
+
+// a {"pong":ms} reply, data messages never carry a pong field
+func parsePong(message []byte) (*WsPong, bool) {
+	if !bytes.Contains(message, []byte(`"pong"`)) {
+		return nil, false
+	}
+	pong := &WsPong{}
+	if err := json.Unmarshal(message, pong); err != nil || pong.Pong == 0 {
+		return nil, false
+	}
+	return pong, true
+}
@@ -0,0 +1,166 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/24 下午3:10
+ */
+package ndex
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNdexWs_HeartbeatStats(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{Host: standIn.wsHost(), PingInterval: 20 * time.Millisecond}
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	stats := ws.Stats()
+	for stats.LastPong.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no pong recorded %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+		stats = ws.Stats()
+	}
+	if stats.State != ConnStateConnected {
+		t.Errorf("state %s", stats.State)
+	}
+	if stats.Latency < 0 || stats.Latency > time.Second {
+		t.Errorf("latency %s", stats.Latency)
+	}
+	if stats.LastPing.IsZero() {
+		t.Error("no ping recorded")
+	}
+	if since := time.Since(stats.LastMessage); since > time.Second {
+		t.Errorf("last message %s ago", since)
+	}
+	if stats.Reconnects != 0 {
+		t.Errorf("%d reconnects", stats.Reconnects)
+	}
+}
+
+func TestNdexWs_HeartbeatTimeout(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{
+		Host:				standIn.wsHost(),
+		ReconnectBackoff:	testReconnectBackoff,
+		PingInterval:		20 * time.Millisecond,
+		MaxMissedPongs:		2,
+	}
+	changes := ws.StateChanges()
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close(context.Background())
+	waitState(t, changes, ConnStateConnected)
+
+	// the connection stays open but goes silent
+	atomic.StoreInt32(&standIn.mute, 1)
+	if change := waitState(t, changes, ConnStateReconnecting); !errors.Is(change.Err, ErrHeartbeatTimeout) {
+		t.Errorf("connection lost with %v", change.Err)
+	}
+	atomic.StoreInt32(&standIn.mute, 0)
+	waitState(t, changes, ConnStateConnected)
+	if stats := ws.Stats(); stats.Reconnects != 1 || stats.MissedPongs > 1 {
+		t.Errorf("stats after the reconnect %+v", stats)
+	}
+}
+
+func TestWithWsHeartbeat(t *testing.T) {
+	if _, err := NewMarket(WithWsHeartbeat(0, 3)); err == nil {
+		t.Error("zero ping interval was accepted")
+	}
+	if _, err := NewMarket(WithWsHeartbeat(time.Second, 0)); err == nil {
+		t.Error("zero missed pongs was accepted")
+	}
+	m, err := NewMarket(WithWsHeartbeat(time.Second, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := m.WsStats(); stats.State != ConnStateClosed || !stats.LastMessage.IsZero() {
+		t.Errorf("stats before dialing %+v", stats)
+	}
+}
+
+func TestNdexWs_HeartbeatSlowSubscriber(t *testing.T) {
+	standIn := newWsStandIn(t, []string{"S0"}, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{Host: standIn.wsHost(), PingInterval: 10 * time.Millisecond, MaxMissedPongs: 2}
+	changes := ws.StateChanges()
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close(context.Background())
+	books, err := ws.SubscribeOrderBook("S0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// far slower than the stand-in pushes, the backlog fills every buffer
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		<-books
+		time.Sleep(5 * time.Millisecond)
+	}
+	for {
+		select {
+		case change := <-changes:
+			if change.To == ConnStateReconnecting {
+				t.Fatalf("a slow subscriber dropped the connection: %v", change.Err)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if stats := ws.Stats(); stats.LastPong.IsZero() {
+		t.Errorf("no pong recorded %+v", stats)
+	}
+}
+
+func TestParsePong(t *testing.T) {
+	if pong, ok := parsePong([]byte(`{"pong":1589271332077}`)); !ok || pong.Pong != 1589271332077 {
+		t.Errorf("pong %+v %v", pong, ok)
+	}
+	for _, message := range []string{`{"channel":"apiOrderBook","data":{"symbol":"pong"}}`, `{"ping":1}`, `not json "pong"`} {
+		if _, ok := parsePong([]byte(message)); ok {
+			t.Errorf("%s taken as a pong", message)
+		}
+	}
+}
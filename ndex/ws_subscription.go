@@ -0,0 +1,228 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/21 上午10:00
+ */
+package ndex
+
+import (
+	"strings"
+	"sync"
+)
+
+/**
+ * A subscribed channel. The event channel is only closed once no dispatch is sending on it,
+ * a dispatch blocked on a full channel is released by done
+ * 已订阅的频道。只有在没有分发正在发送时才会关闭事件 channel，阻塞在已满 channel 上的分发通过 done 释放
+ */
+type subscription struct {
+	WsSubInfo
+	unsubMessage	string			// sent by Close
+	mu			sync.RWMutex	// read-held by every send, write-held to close Event
+	done		chan struct{}
+	closed		bool
+}
+
+func newSubscription(channel, subMessage, unsubMessage string, event interface{}) *subscription {
+	return &subscription{
+		WsSubInfo:		WsSubInfo{Channel: channel, SubMessage: subMessage, Event: event},
+		unsubMessage:	unsubMessage,
+		done:			make(chan struct{}),
+	}
+}
+
+// deliver v to the subscriber, false if the subscription was closed before v was taken
+func (sub *subscription) send(v interface{}) bool {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	if sub.closed {
+		return false
+	}
+	switch event := sub.Event.(type) {
+	case chan *OrderBook:
+		select {
+		case event <- v.(*OrderBook):
+			return true
+		case <-sub.done:
+		}
+	case chan *WsOrderChange:
+		select {
+		case event <- v.(*WsOrderChange):
+			return true
+		case <-sub.done:
+		}
+	case chan *WsBalanceChange:
+		select {
+		case event <- v.(*WsBalanceChange):
+			return true
+		case <-sub.done:
+		}
+	}
+	return false
+}
+
+// tell the subscriber that updates may have been missed, the marker carries the symbol or address of the channel
+func (sub *subscription) sendResync() {
+	switch sub.Event.(type) {
+	case chan *OrderBook:
+		sub.send(&OrderBook{Symbol: strings.TrimPrefix(sub.Channel, "apiOrderBook:"), Resync: true})
+	case chan *WsOrderChange:
+		sub.send(&WsOrderChange{Resync: true})
+	case chan *WsBalanceChange:
+		sub.send(&WsBalanceChange{A: strings.TrimPrefix(sub.Channel, "account:"), Resync: true})
+	}
+}
+
+// called once, by whoever removed the subscription from the registry
+func (sub *subscription) close() {
+	close(sub.done)
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	switch event := sub.Event.(type) {
+	case chan *OrderBook:
+		close(event)
+	case chan *WsOrderChange:
+		close(event)
+	case chan *WsBalanceChange:
+		close(event)
+	}
+}
+
+/**
+ * The subscriptions of a websocket, safe for concurrent subscribe, unsubscribe, dispatch and resubscribe
+ * websocket 的订阅表，可并发订阅、取消订阅、分发及重新订阅
+ */
+type subscriptionRegistry struct {
+	mu		sync.RWMutex
+	subs	map[string]*subscription
+}
+
+// the subscription of channel, created with newEvent if there is none; created reports whether it is new
+func (registry *subscriptionRegistry) getOrAdd(channel, subMessage, unsubMessage string, newEvent func() interface{}) (sub *subscription, created bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if sub := registry.subs[channel]; sub != nil {
+		return sub, false
+	}
+	if registry.subs == nil {
+		registry.subs = map[string]*subscription{}
+	}
+	sub = newSubscription(channel, subMessage, unsubMessage, newEvent())
+	registry.subs[channel] = sub
+	return sub, true
+}
+
+func (registry *subscriptionRegistry) get(channel string) *subscription {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.subs[channel]
+}
+
+// remove and close the subscription of channel, false if there was none
+func (registry *subscriptionRegistry) remove(channel string) bool {
+	registry.mu.Lock()
+	sub := registry.subs[channel]
+	delete(registry.subs, channel)
+	registry.mu.Unlock()
+	if sub == nil {
+		return false
+	}
+	sub.close()
+	return true
+}
+
+// remove sub only if it is still the registered one, used to undo a subscribe whose message could not be sent
+func (registry *subscriptionRegistry) removeIf(sub *subscription) {
+	registry.mu.Lock()
+	registered := registry.subs[sub.Channel] == sub
+	if registered {
+		delete(registry.subs, sub.Channel)
+	}
+	registry.mu.Unlock()
+	if registered {
+		sub.close()
+	}
+}
+
+// the subscribe messages of every channel, a snapshot for resubscribing after a reconnect
+func (registry *subscriptionRegistry) subMessages() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	messages := make([]string, 0, len(registry.subs))
+	for _, sub := range registry.subs {
+		messages = append(messages, sub.SubMessage)
+	}
+	return messages
+}
+
+// the unsubscribe messages of every channel, sent when the websocket is closed
+func (registry *subscriptionRegistry) unsubMessages() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	messages := make([]string, 0, len(registry.subs))
+	for _, sub := range registry.subs {
+		messages = append(messages, sub.unsubMessage)
+	}
+	return messages
+}
+
+func (registry *subscriptionRegistry) all() []*subscription {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	subs := make([]*subscription, 0, len(registry.subs))
+	for _, sub := range registry.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// send the resync marker to every subscriber
+func (registry *subscriptionRegistry) resync() {
+	for _, sub := range registry.all() {
+		sub.sendResync()
+	}
+}
+
+// remove and close every subscription
+func (registry *subscriptionRegistry) closeAll() {
+	registry.mu.Lock()
+	subs := registry.subs
+	registry.subs = nil
+	registry.mu.Unlock()
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+// deliver v to the subscriber of channel, if any
+func (registry *subscriptionRegistry) dispatch(channel string, v interface{}) bool {
+	sub := registry.get(channel)
+	if sub == nil {
+		return false
+	}
+	return sub.send(v)
+}
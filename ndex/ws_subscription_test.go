@@ -0,0 +1,271 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/21 上午10:00
+ */
+package ndex
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// a local stand-in for the ndex websocket, it answers pings and pushes order books and order changes until stopped
+type wsStandIn struct {
+	*httptest.Server
+	stop		chan struct{}
+	wg			sync.WaitGroup
+	symbols		[]string
+	refuse		int32	// reject handshakes while set
+	mute		int32	// neither push data nor answer pings while set, like a half-open connection
+
+	mu			sync.Mutex
+	conns		map[*websocket.Conn]bool
+	received	[]string
+	closeCodes	[]int	// codes of the close frames received from clients
+}
+
+// close every open connection from the server side
+func (standIn *wsStandIn) dropAll() {
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	for conn := range standIn.conns {
+		conn.Close()
+	}
+}
+
+// messages received with the given prefix
+func (standIn *wsStandIn) messages(prefix string) []string {
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	var messages []string
+	for _, message := range standIn.received {
+		if strings.HasPrefix(message, prefix) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func newWsStandIn(t *testing.T, symbols []string, address string) *wsStandIn {
+	standIn := &wsStandIn{stop: make(chan struct{}), symbols: symbols, conns: map[*websocket.Conn]bool{}}
+	upgrader := websocket.Upgrader{}
+	standIn.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&standIn.refuse) != 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		standIn.mu.Lock()
+		standIn.conns[conn] = true
+		standIn.mu.Unlock()
+		defer func() {
+			standIn.mu.Lock()
+			delete(standIn.conns, conn)
+			standIn.mu.Unlock()
+			conn.Close()
+		}()
+		var writeMu sync.Mutex
+		write := func(msg []byte) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return conn.WriteMessage(websocket.TextMessage, msg)
+		}
+		standIn.wg.Add(1)
+		go func() {
+			defer standIn.wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-standIn.stop:
+					return
+				default:
+				}
+				if atomic.LoadInt32(&standIn.mute) != 0 {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				symbol := symbols[i % len(symbols)]
+				book := fmt.Sprintf(`{"channel":"apiOrderBook","action":"Data","status":200,"data":{"symbol":"%s","updateTime":%d,"sellList":[],"buyList":[]}}`, symbol, i)
+				order := fmt.Sprintf(`{"channel":"order","action":"Data","status":200,"data":{"t":"update","d":[{"id":"%d","symbol":"%s","address":"%s","status":1}]}}`, i, symbol, address)
+				if write([]byte(book)) != nil || write([]byte(order)) != nil {
+					return
+				}
+				time.Sleep(50 * time.Microsecond)
+			}
+		}()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				if closeErr, ok := err.(*websocket.CloseError); ok {
+					standIn.mu.Lock()
+					standIn.closeCodes = append(standIn.closeCodes, closeErr.Code)
+					standIn.mu.Unlock()
+				}
+				return
+			}
+			standIn.mu.Lock()
+			standIn.received = append(standIn.received, string(message))
+			standIn.mu.Unlock()
+			var ping struct {
+				Ping	int64	`json:"ping"`
+			}
+			if json.Unmarshal(message, &ping) == nil && ping.Ping != 0 && atomic.LoadInt32(&standIn.mute) == 0 {
+				write([]byte(fmt.Sprintf(`{"pong":%d}`, ping.Ping)))
+			}
+		}
+	}))
+	return standIn
+}
+
+func (standIn *wsStandIn) wsHost() string {
+	return "ws" + strings.TrimPrefix(standIn.URL, "http")
+}
+
+func (standIn *wsStandIn) Close() {
+	close(standIn.stop)
+	standIn.wg.Wait()
+	standIn.Server.CloseClientConnections()
+	standIn.Server.Close()
+}
+
+func TestNdexWs_SubscriptionStress(t *testing.T) {
+	symbols := []string{"S0", "S1", "S2", "S3", "S4", "S5", "S6", "S7"}
+	standIn := newWsStandIn(t, symbols, testAddress)
+	defer standIn.Close()
+
+	ws := &NdexWs{Host: standIn.wsHost()}
+	if err := ws.Conn(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	var wg sync.WaitGroup
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(int64(worker)))
+			for time.Now().Before(deadline) {
+				symbol := symbols[random.Intn(len(symbols))]
+				switch random.Intn(4) {
+				case 0, 1:
+					event, err := ws.SubscribeOrderBook(symbol, 10)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					// some subscribers drain until the channel is closed, others stop reading so dispatch blocks
+					if worker % 2 == 0 {
+						go func() {
+							for range event {
+							}
+						}()
+					}
+				case 2:
+					if err := ws.UnSubscribeOrderBook(symbol); err != nil {
+						t.Error(err)
+						return
+					}
+				case 3:
+					event, err := ws.SubscribeOrderChange(testAddress)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					select {
+					case <-event:
+					default:
+					}
+					if random.Intn(2) == 0 {
+						ws.UnSubscribeOrderChange(testAddress)
+					}
+				}
+				ws.subscriptions.subMessages()
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	// every channel left is closed by unsubscribing, a dispatch blocked on a full channel must not hold it open
+	for _, symbol := range symbols {
+		done := make(chan struct{})
+		go func(symbol string) {
+			ws.UnSubscribeOrderBook(symbol)
+			close(done)
+		}(symbol)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("unsubscribing %s blocked", symbol)
+		}
+	}
+	ws.UnSubscribeOrderChange(testAddress)
+	if messages := ws.subscriptions.subMessages(); len(messages) != 0 {
+		t.Errorf("%d subscriptions left", len(messages))
+	}
+}
+
+func TestSubscriptionRegistry_CloseWhileSending(t *testing.T) {
+	var registry subscriptionRegistry
+	sub, created := registry.getOrAdd("apiOrderBook:S0", "sub", "unsub", func() interface{} {
+		return make(chan *OrderBook)
+	})
+	if !created {
+		t.Fatal("subscription was not created")
+	}
+	sent := make(chan bool)
+	go func() {
+		// nobody reads the unbuffered channel, the send only ends by closing
+		sent <- registry.dispatch("apiOrderBook:S0", &OrderBook{Symbol: "S0"})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if !registry.remove("apiOrderBook:S0") || registry.remove("apiOrderBook:S0") {
+		t.Error("remove reported the wrong result")
+	}
+	if <-sent {
+		t.Error("send reported delivery to a closed subscription")
+	}
+	if _, ok := <-sub.Event.(chan *OrderBook); ok {
+		t.Error("event channel is still open")
+	}
+	if registry.dispatch("apiOrderBook:S0", &OrderBook{}) {
+		t.Error("dispatch to a removed channel")
+	}
+}
@@ -29,59 +29,150 @@ Copyright (c) 2019-2020 nerve.network
 package utils
 
 import (
+	"context"
+	"crypto/tls"
 	json2 "encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 )
 
-func RequestGet(url string) ([]byte, error) {
-	h := NewHttpSend(url)
-	content, err := h.Get()
-	return content, err
-}
+const DefaultUserAgent = "ndex-go-sdk"
 
-func RequestHttpGet(url string, params map[string]interface{}) ([]byte, error) {
-	client := http.Client{}
-	json,error := json2.Marshal(params)
-	if error != nil {
-		return nil, error
-	}
-	request, err := http.NewRequest("GET", url, strings.NewReader(string(json))) //请求
-	if err != nil {
-		return nil, err // handle error
-	}
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8") //设置Content-Type
-	request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/67.0.3396.99 Safari/537.36") //设置User-Agent
-	response, err := client.Do(request)                //返回
+/**
+ * The largest response body read from a server, a longer body fails with ErrResponseTooLarge instead of being read into memory
+ * 从服务器读取的响应体的最大长度，超出时返回 ErrResponseTooLarge，而不是全部读入内存
+ */
+const MaxResponseSize = 16 << 20
+
+var ErrResponseTooLarge = errors.New("response body exceeds MaxResponseSize")
+
+// read a response body of at most MaxResponseSize bytes
+func readBody(body io.Reader) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(body, MaxResponseSize + 1))
 	if err != nil {
 		return nil, err
 	}
-	if response == nil || response.Body == nil {
-		return nil, errors.New("response is nil")
+	if len(content) > MaxResponseSize {
+		return nil, ErrResponseTooLarge
 	}
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
+	return content, nil
+}
+
+/**
+ * DefaultClient is used by the package level request functions, it keeps connections alive between calls
+ * 包级别的请求函数使用 DefaultClient，多次调用之间复用连接
+ */
+var DefaultClient = NewClient(nil)
+
+/**
+ * Client sends json requests through a single http.Client, so TCP/TLS sessions are reused between calls
+ * Client 通过同一个 http.Client 发送 json 请求，多次调用之间复用 TCP/TLS 连接
+ */
+type Client struct {
+	HttpClient *http.Client
+	Header     map[string]string
+	UserAgent  string
+}
+
+/**
+ * Create a client, a nil httpClient uses a keep-alive transport with certificate verification enabled
+ * 创建客户端，httpClient 为 nil 时使用开启证书校验、保持长连接的 transport
+ */
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Transport: NewTransport(nil, nil)}
+	}
+	return &Client{
+		HttpClient: httpClient,
+		UserAgent:  DefaultUserAgent,
 	}
-	return body, nil
 }
 
-func RequestPost(url string, params map[string]interface{}) ([]byte, error) {
-	client := http.Client{}
-	json,error := json2.Marshal(params)
-	if error != nil {
-		return nil, error
+/**
+ * Create a pooled transport, tlsConfig and proxy are optional; a nil proxy falls back to the environment settings
+ * 创建带连接池的 transport，tlsConfig 和 proxy 可为空，proxy 为空时使用环境变量中的代理配置
+ */
+func NewTransport(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
 	}
-	request, err := http.NewRequest("POST", url, strings.NewReader(string(json))) //请求
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.do(ctx, "GET", url, nil)
+}
+
+func (c *Client) GetJson(ctx context.Context, url string, params map[string]interface{}) ([]byte, error) {
+	return c.do(ctx, "GET", url, params)
+}
+
+func (c *Client) Post(ctx context.Context, url string, params map[string]interface{}) ([]byte, error) {
+	return c.do(ctx, "POST", url, params)
+}
+
+/**
+ * Post any value encodable as json, such as a request struct shared with the server
+ * 以 json 形式提交任意可编码的值，例如与服务端共用的请求结构体
+ */
+func (c *Client) PostJson(ctx context.Context, url string, body interface{}) ([]byte, error) {
+	return c.do(ctx, "POST", url, body)
+}
+
+func (c *Client) do(ctx context.Context, method, url string, params interface{}) ([]byte, error) {
+	// a nil map sends no body, as before PostJson existed
+	if m, ok := params.(map[string]interface{}); ok && m == nil {
+		params = nil
+	}
+	var payload string
+	if params != nil {
+		json, err := json2.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		payload = string(json)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(payload))
 	if err != nil {
-		return nil, err // handle error
+		return nil, err
 	}
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8") //设置Content-Type
-	request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/67.0.3396.99 Safari/537.36") //设置User-Agent
-	response, err := client.Do(request)                //返回
+	if params != nil {
+		request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+	for k, v := range c.Header {
+		if strings.ToLower(k) == "host" {
+			request.Host = v
+		} else {
+			request.Header.Set(k, v)
+		}
+	}
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -89,9 +180,50 @@ func RequestPost(url string, params map[string]interface{}) ([]byte, error) {
 		return nil, errors.New("response is nil")
 	}
 	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+	body, err := readBody(response.Body)
 	if err != nil {
 		return nil, err
 	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &HttpError{StatusCode: response.StatusCode, URL: url, Body: body}
+	}
 	return body, nil
 }
+
+func RequestGet(url string) ([]byte, error) {
+	return RequestGetCtx(context.Background(), url)
+}
+
+/**
+ * Same as RequestGet, the request is cancelled when ctx is done
+ * 同 RequestGet，ctx 结束时取消请求
+ */
+func RequestGetCtx(ctx context.Context, url string) ([]byte, error) {
+	h := NewHttpSend(url)
+	content, err := h.GetCtx(ctx)
+	return content, err
+}
+
+func RequestHttpGet(url string, params map[string]interface{}) ([]byte, error) {
+	return RequestHttpGetCtx(context.Background(), url, params)
+}
+
+/**
+ * Same as RequestHttpGet, the request is cancelled when ctx is done
+ * 同 RequestHttpGet，ctx 结束时取消请求
+ */
+func RequestHttpGetCtx(ctx context.Context, url string, params map[string]interface{}) ([]byte, error) {
+	return DefaultClient.GetJson(ctx, url, params)
+}
+
+func RequestPost(url string, params map[string]interface{}) ([]byte, error) {
+	return RequestPostCtx(context.Background(), url, params)
+}
+
+/**
+ * Same as RequestPost, the request is cancelled when ctx is done
+ * 同 RequestPost，ctx 结束时取消请求
+ */
+func RequestPostCtx(ctx context.Context, url string, params map[string]interface{}) ([]byte, error) {
+	return DefaultClient.Post(ctx, url, params)
+}
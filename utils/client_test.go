@@ -29,7 +29,10 @@ Copyright (c) 2019-2020 nerve.network
 package utils
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -41,3 +44,42 @@ func  TestRequestGet(t *testing.T) {
 	}
 	fmt.Println(string(res))
 }
+
+
+func TestClient_VerifiesCertificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(nil).Get(context.Background(), server.URL); err == nil {
+		t.Fatal("self-signed certificate was accepted by the default client")
+	}
+	res, err := NewClient(server.Client()).Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != "ok" {
+		t.Fatalf("unexpected body %q", res)
+	}
+}
+
+func TestClient_ResponseSizeLimit(t *testing.T) {
+	size := MaxResponseSize
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, size))
+	}))
+	defer server.Close()
+
+	res, err := NewClient(nil).Get(context.Background(), server.URL)
+	if err != nil || len(res) != MaxResponseSize {
+		t.Fatalf("%d bytes, %v", len(res), err)
+	}
+	size++
+	if _, err := NewClient(nil).Get(context.Background(), server.URL); err != ErrResponseTooLarge {
+		t.Errorf("oversized body returned %v", err)
+	}
+	if _, err := RequestGet(server.URL); err != ErrResponseTooLarge {
+		t.Errorf("oversized body returned %v through HttpSend", err)
+	}
+}
@@ -29,11 +29,8 @@ Copyright (c) 2019-2020 nerve.network
 package utils
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -52,6 +49,7 @@ type HttpSend struct {
 	SendType string
 	Header   map[string]string
 	Body     map[string]string
+	Client   *http.Client
 	sync.RWMutex
 }
 
@@ -59,9 +57,16 @@ func NewHttpSend(link string) *HttpSend {
 	return &HttpSend{
 		Link:     link,
 		SendType: SENDTYPE_FROM,
+		Client:   DefaultClient.HttpClient,
 	}
 }
 
+func (h *HttpSend) SetClient(client *http.Client) {
+	h.Lock()
+	defer h.Unlock()
+	h.Client = client
+}
+
 func (h *HttpSend) SetBody(body map[string]string) {
 	h.Lock()
 	defer h.Unlock()
@@ -81,11 +86,19 @@ func (h *HttpSend) SetSendType(send_type string) {
 }
 
 func (h *HttpSend) Get() ([]byte, error) {
-	return h.send(GET_METHOD)
+	return h.send(context.Background(), GET_METHOD)
+}
+
+func (h *HttpSend) GetCtx(ctx context.Context) ([]byte, error) {
+	return h.send(ctx, GET_METHOD)
 }
 
 func (h *HttpSend) Post() ([]byte, error) {
-	return h.send(POST_METHOD)
+	return h.send(context.Background(), POST_METHOD)
+}
+
+func (h *HttpSend) PostCtx(ctx context.Context) ([]byte, error) {
+	return h.send(ctx, POST_METHOD)
 }
 
 func GetUrlBuild(link string, data map[string]string) string {
@@ -98,11 +111,11 @@ func GetUrlBuild(link string, data map[string]string) string {
 	return u.String()
 }
 
-func (h *HttpSend) send(method string) ([]byte, error) {
+func (h *HttpSend) send(ctx context.Context, method string) ([]byte, error) {
 	var (
 		req       *http.Request
 		resp      *http.Response
-		client    http.Client
+		client    *http.Client
 		send_data string
 		err       error
 	)
@@ -124,12 +137,13 @@ func (h *HttpSend) send(method string) ([]byte, error) {
 		}
 	}
 
-	//忽略https的证书
-	client.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	//复用连接，证书校验由 client 的 transport 决定
+	client = h.Client
+	if client == nil {
+		client = DefaultClient.HttpClient
 	}
 
-	req, err = http.NewRequest(method, h.Link, strings.NewReader(send_data))
+	req, err = http.NewRequestWithContext(ctx, method, h.Link, strings.NewReader(send_data))
 	if err != nil {
 		return nil, err
 	}
@@ -163,9 +177,12 @@ func (h *HttpSend) send(method string) ([]byte, error) {
 	}
 	defer resp.Body.Close()
 
+	body, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New(fmt.Sprintf("error http code :%d", resp.StatusCode))
+		return nil, &HttpError{StatusCode: resp.StatusCode, URL: h.Link, Body: body}
 	}
-
-	return ioutil.ReadAll(resp.Body)
+	return body, nil
 }
\ No newline at end of file
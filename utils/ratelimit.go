@@ -0,0 +1,168 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 上午10:00
+ */
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+/**
+ * Returned by RateLimiter.Wait when the required wait would outlive the context deadline
+ * 当需要等待的时间超过 context 的截止时间时，RateLimiter.Wait 返回此错误
+ */
+var ErrRateLimitWait = errors.New("rate limit wait exceeds context deadline")
+
+/**
+ * RateLimiter is a token bucket, it is safe for concurrent use
+ * RateLimiter 为令牌桶限流器，可并发使用
+ */
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	stats RateLimiterStats
+}
+
+/**
+ * Metrics of a RateLimiter
+ * 限流器的统计信息
+ */
+type RateLimiterStats struct {
+	Requests  int64         // successful Wait/Allow calls
+	Waited    int64         // calls that had to wait for a token
+	Rejected  int64         // calls that failed fast or were cancelled
+	TotalWait time.Duration // sum of the time spent waiting
+	MaxWait   time.Duration
+}
+
+func NewRateLimiter(ratePerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill the bucket, the caller holds the lock
+func (l *RateLimiter) advance(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed > 0 {
+		l.tokens += elapsed * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+/**
+ * Take a token without waiting
+ * 不等待，尝试获取一个令牌
+ */
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	if l.tokens < 1 {
+		l.stats.Rejected++
+		return false
+	}
+	l.tokens--
+	l.stats.Requests++
+	return true
+}
+
+/**
+ * Block until a token is available. If the wait would pass the ctx deadline it fails immediately with ErrRateLimitWait.
+ * 阻塞直到获取令牌，如果等待时间会超过 ctx 的截止时间则立即返回 ErrRateLimitWait
+ */
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.advance(now)
+	var wait time.Duration
+	if l.tokens < 1 {
+		if l.rate <= 0 {
+			l.stats.Rejected++
+			l.mu.Unlock()
+			return ErrRateLimitWait
+		}
+		wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	if deadline, ok := ctx.Deadline(); ok && wait > 0 && deadline.Sub(now) < wait {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return ErrRateLimitWait
+	}
+	// reserve the token now, waiters are served in arrival order
+	l.tokens--
+	l.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			l.mu.Lock()
+			l.tokens++
+			l.stats.Rejected++
+			l.mu.Unlock()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	l.mu.Lock()
+	l.stats.Requests++
+	if wait > 0 {
+		l.stats.Waited++
+		l.stats.TotalWait += wait
+		if wait > l.stats.MaxWait {
+			l.stats.MaxWait = wait
+		}
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
@@ -0,0 +1,76 @@
+/**
+* MIT License
+* <p>
+Copyright (c) 2019-2020 nerve.network
+* <p>
+* Permission is hereby granted, free of charge, to any person obtaining a copy
+* of this software and associated documentation files (the "Software"), to deal
+* in the Software without restriction, including without limitation the rights
+* to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+* copies of the Software, and to permit persons to whom the Software is
+* furnished to do so, subject to the following conditions:
+* <p>
+* The above copyright notice and this permission notice shall be included in all
+* copies or substantial portions of the Software.
+* <p>
+* THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+* IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+* FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+* AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+* LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+* OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+* SOFTWARE.
+*/
+
+/**
+ * @Author: nerve.network core team
+ * @Date: 2020/6/5 上午11:20
+ */
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter(20, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// two tokens from the burst, two more at 20/s
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("4 tokens taken in %s", elapsed)
+	}
+	stats := limiter.Stats()
+	if stats.Requests != 4 || stats.Waited != 2 || stats.TotalWait <= 0 || stats.MaxWait <= 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimiter_FailFast(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	if !limiter.Allow() {
+		t.Fatal("first token should be available")
+	}
+	if limiter.Allow() {
+		t.Fatal("bucket should be empty")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx); !errors.Is(err, ErrRateLimitWait) {
+		t.Fatalf("err = %v", err)
+	}
+	if time.Since(start) > 20*time.Millisecond {
+		t.Error("Wait blocked although the deadline was too short")
+	}
+	if limiter.Stats().Rejected != 2 {
+		t.Errorf("unexpected stats %+v", limiter.Stats())
+	}
+}